@@ -1,22 +1,43 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/WinBeyond/btrfs-read/pkg/device"
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
 	"github.com/WinBeyond/btrfs-read/pkg/fs"
 	"github.com/WinBeyond/btrfs-read/pkg/logger"
 	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
 )
 
 var (
-	jsonOutput bool
-	logLevel   string
+	jsonOutput  bool
+	logLevel    string
+	subvolPath  string
+	subvolID    uint64
+	backupRoot  int
+	devicePaths stringList
 )
 
+// stringList is a flag that may be given several times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
@@ -35,6 +56,33 @@ func main() {
 	case "ls":
 		cmdLs()
 
+	case "stat":
+		cmdStat()
+
+	case "readlink":
+		cmdReadlink()
+
+	case "getfattr":
+		cmdGetfattr()
+
+	case "getfacl":
+		cmdGetfacl()
+
+	case "subvolume":
+		cmdSubvolume()
+
+	case "scan":
+		cmdScan()
+
+	case "device":
+		cmdDevice()
+
+	case "physical-to-logical":
+		cmdPhysicalToLogical()
+
+	case "logical-resolve":
+		cmdLogicalResolve()
+
 	default:
 		// Backward compatibility: treat a path-like first argument as info.
 		if len(os.Args) == 2 {
@@ -51,78 +99,136 @@ func main() {
 func printUsage() {
 	fmt.Println("Usage: btrfs-read <command> [options] [args]")
 	fmt.Println("\nCommands:")
-	fmt.Println("  info <image>              - Show superblock information")
+	fmt.Println("  info [--full] <image>     - Show superblock information (--full: every field and backup roots)")
 	fmt.Println("  ls <image> [path]         - List directory contents")
 	fmt.Println("  cat <image> <path>        - Read file content")
+	fmt.Println("  stat <image> <path>       - Show inode metadata")
+	fmt.Println("  readlink <image> <path>   - Print symbolic link target")
+	fmt.Println("  getfattr <image> <path>   - Dump extended attributes")
+	fmt.Println("  getfacl <image> <path>    - Show POSIX access control lists")
+	fmt.Println("  subvolume list <image>    - List subvolumes and snapshots")
+	fmt.Println("  scan <path|glob>...       - Find btrfs devices and group them by filesystem")
+	fmt.Println("  device stats <image>      - Show the error counters of each device")
+	fmt.Println("  physical-to-logical <image> <offset>")
+	fmt.Println("                            - Find the logical address stored at a device offset")
+	fmt.Println("  logical-resolve <image> <logical>")
+	fmt.Println("                            - List the files whose data is at a logical address")
 	fmt.Println("\nGlobal Options:")
 	fmt.Println("  --log-level, -l <level>   - Set log level: debug, info, warn, error (default: info)")
 	fmt.Println("\nCommand Options:")
-	fmt.Println("  --json                    - Output in JSON format (for ls and cat commands)")
+	fmt.Println("  --json                    - Output in JSON format (for ls, cat, stat, readlink, getfattr, getfacl, subvolume list, scan, device stats, physical-to-logical and logical-resolve)")
+	fmt.Println("  -L, --dereference         - Follow a symlink in the last path component (for stat)")
+	fmt.Println("  -n <name>                 - Dump only the named attribute (for getfattr)")
+	fmt.Println("  -e <encoding>             - Encode values as text, hex or base64 (for getfattr)")
+	fmt.Println("  -s, -r                    - Only snapshots, only read-only subvolumes (for subvolume list)")
+	fmt.Println("  -c, --check               - Exit with status 64 if any error counter is not zero (for device stats)")
+	fmt.Println("  --devid <id>              - Device of the offset, default the device of <image> (for physical-to-logical)")
+	fmt.Println("  --lba                     - The offset is in 512-byte sectors (for physical-to-logical)")
+	fmt.Println("  -P                        - Print inode numbers, offsets and roots instead of paths (for logical-resolve)")
+	fmt.Println("  --subvol <path>           - Browse the subvolume at this path instead of the default")
+	fmt.Println("  --subvolid <id>           - Browse the subvolume with this ID instead of the default")
+	fmt.Println("  --backup-root <n>         - Try at most n superblock backup roots, newest first, if the tree roots are damaged")
+	fmt.Println("  --device <image>          - Another member of a multi-device filesystem (repeatable)")
 	fmt.Println("\nExamples:")
 	fmt.Println("  btrfs-read info tests/testdata/test.img")
 	fmt.Println("  btrfs-read ls tests/testdata/test.img /")
 	fmt.Println("  btrfs-read ls --json tests/testdata/test.img /")
 	fmt.Println("  btrfs-read cat tests/testdata/test.img /hello.txt")
 	fmt.Println("  btrfs-read cat --json tests/testdata/test.img /hello.txt")
+	fmt.Println("  btrfs-read stat tests/testdata/test.img /hello.txt")
+	fmt.Println("  btrfs-read readlink tests/testdata/test.img /link.txt")
+	fmt.Println("  btrfs-read getfattr tests/testdata/test.img /hello.txt")
+	fmt.Println("  btrfs-read getfacl tests/testdata/test.img /etc")
+	fmt.Println("  btrfs-read subvolume list tests/testdata/test.img")
+	fmt.Println("  btrfs-read ls --subvol snapshots/2026-10-01 backup.img /")
+	fmt.Println("  btrfs-read ls --device disk2.img --device disk3.img disk1.img /")
+	fmt.Println("  btrfs-read scan /evidence/ '/mnt/intake/*.img'")
+	fmt.Println("  btrfs-read device stats --device disk2.img disk1.img")
+	fmt.Println("  btrfs-read physical-to-logical --lba --devid 2 --device disk2.img disk1.img 1953525100")
+	fmt.Println("  btrfs-read logical-resolve tests/testdata/test.img 0x1500000")
 	fmt.Println("  btrfs-read -l debug ls tests/testdata/test.img /")
 }
 
 func cmdInfo() {
-	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: btrfs-read info <image>")
+	flagSet := flag.NewFlagSet("info", flag.ExitOnError)
+	full := flagSet.Bool("full", false, "Show every superblock field, including backup roots")
+	flagSet.Parse(os.Args[2:])
+
+	if flagSet.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read info [--full] <image>")
 		os.Exit(1)
 	}
-	devicePath := os.Args[2]
-	cmdInfoLegacy(devicePath)
+	showInfo(flagSet.Arg(0), *full)
 }
 
 func cmdInfoLegacy(devicePath string) {
+	showInfo(devicePath, false)
+}
+
+func showInfo(devicePath string, full bool) {
 	fmt.Printf("=== Btrfs CLI Tool ===\n")
 	fmt.Printf("Reading device: %s\n\n", devicePath)
 
 	// Open device.
-	file, err := os.Open(devicePath)
+	dev, err := device.NewFileDevice(devicePath)
 	if err != nil {
 		fmt.Printf("Error opening device: %v\n", err)
 		os.Exit(1)
 	}
-	defer file.Close()
+	defer dev.Close()
 
-	// Read superblock.
-	const superblockOffset = 0x10000
-	const superblockSize = 4096
-
-	buf := make([]byte, superblockSize)
-	n, err := file.ReadAt(buf, superblockOffset)
-	if err != nil {
-		fmt.Printf("Error reading superblock: %v\n", err)
-		os.Exit(1)
+	// Read and verify every superblock mirror, then show the newest valid
+	// one, as Open would use it.
+	copies := device.NewSuperblockReader(dev).ReadAll()
+	var latest *device.SuperblockCopy
+	for _, c := range copies {
+		if c.Status == device.SuperblockValid && (latest == nil || c.Generation > latest.Generation) {
+			latest = c
+		}
 	}
-	if n != superblockSize {
-		fmt.Printf("Error: read %d bytes, expected %d\n", n, superblockSize)
+	if latest == nil {
+		printSuperblockMirrors(copies, nil)
+		fmt.Printf("Error: %v\n", errors.ErrNoValidSuperblock)
 		os.Exit(1)
 	}
 
-	fmt.Println("✓ Successfully read superblock data")
+	fmt.Printf("✓ Using superblock copy %d at 0x%x\n", latest.Index, latest.Offset)
 	fmt.Println()
 
-	// Parse superblock.
-	sb := &ondisk.Superblock{}
-	if err := sb.Unmarshal(buf); err != nil {
-		fmt.Printf("Error parsing superblock: %v\n", err)
-		os.Exit(1)
+	// Display superblock info.
+	if full {
+		printSuperblockFull(latest.Superblock)
+	} else {
+		printSuperblockInfo(latest.Superblock)
 	}
+	printSuperblockMirrors(copies, latest)
+}
 
-	fmt.Println("✓ Successfully parsed superblock")
+// printSuperblockMirrors shows the verification status of each superblock
+// copy and marks the one in use.
+func printSuperblockMirrors(copies []*device.SuperblockCopy, used *device.SuperblockCopy) {
+	fmt.Printf("--- Superblock Mirrors ---\n")
+	for _, c := range copies {
+		status := c.Status.String()
+		if c.Superblock != nil {
+			status += fmt.Sprintf(", generation %d", c.Generation)
+		}
+		if c.Status != device.SuperblockValid && c.Status != device.SuperblockOutOfRange && c.Err != nil {
+			status += fmt.Sprintf(" (%v)", c.Err)
+		}
+		if c == used {
+			status += " [in use]"
+		}
+		fmt.Printf("Copy %d (0x%x): %s\n", c.Index, c.Offset, status)
+	}
 	fmt.Println()
-
-	// Display superblock info.
-	printSuperblockInfo(sb)
 }
 
 func cmdCat() {
 	flagSet := flag.NewFlagSet("cat", flag.ExitOnError)
 	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	addSubvolumeFlags(flagSet)
 	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
 	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
 	flagSet.Parse(os.Args[2:])
@@ -134,7 +240,7 @@ func cmdCat() {
 	}
 
 	if flagSet.NArg() < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: btrfs-read cat [--json] [-l level] <image> <path>")
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read cat [--json] [--subvol path | --subvolid id] [-l level] <image> <path>")
 		os.Exit(1)
 	}
 
@@ -142,12 +248,13 @@ func cmdCat() {
 	filePath := flagSet.Arg(1)
 
 	// Open filesystem.
-	filesystem, err := fs.Open(devicePath)
+	filesystem, err := openFilesystem(devicePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
 		os.Exit(1)
 	}
 	defer filesystem.Close()
+	filesystem = selectSubvolume(filesystem)
 
 	// Read file.
 	data, err := filesystem.ReadFile(filePath)
@@ -183,6 +290,8 @@ func cmdCat() {
 func cmdLs() {
 	flagSet := flag.NewFlagSet("ls", flag.ExitOnError)
 	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	addSubvolumeFlags(flagSet)
 	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
 	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
 	flagSet.Parse(os.Args[2:])
@@ -194,7 +303,7 @@ func cmdLs() {
 	}
 
 	if flagSet.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: btrfs-read ls [--json] [-l level] <image> [path]")
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read ls [--json] [--subvol path | --subvolid id] [-l level] <image> [path]")
 		os.Exit(1)
 	}
 
@@ -205,12 +314,13 @@ func cmdLs() {
 	}
 
 	// Open filesystem.
-	filesystem, err := fs.Open(devicePath)
+	filesystem, err := openFilesystem(devicePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
 		os.Exit(1)
 	}
 	defer filesystem.Close()
+	filesystem = selectSubvolume(filesystem)
 
 	// List directory.
 	entries, err := filesystem.ListDirectory(dirPath)
@@ -243,95 +353,1095 @@ func cmdLs() {
 			fmt.Println("-------------------------------------------")
 			for _, entry := range entries {
 				typeStr := getFileTypeName(entry.Type)
+				if entry.Subvolume != 0 {
+					typeStr = "subvol"
+				}
 				fmt.Printf("%-10s %-15d %s\n", typeStr, entry.Inode, entry.Name)
 			}
 		}
 	}
 }
 
-func getFileTypeName(fileType uint8) string {
-	switch fileType {
-	case 1:
-		return "file"
-	case 2:
-		return "dir"
-	case 3:
-		return "chrdev"
-	case 4:
-		return "blkdev"
-	case 5:
-		return "fifo"
-	case 6:
-		return "sock"
-	case 7:
-		return "symlink"
-	default:
-		return "unknown"
+func cmdStat() {
+	var dereference bool
+
+	flagSet := flag.NewFlagSet("stat", flag.ExitOnError)
+	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	addSubvolumeFlags(flagSet)
+	flagSet.BoolVar(&dereference, "dereference", false, "Follow a symlink in the last path component")
+	flagSet.BoolVar(&dereference, "L", false, "Follow a symlink in the last path component (shorthand)")
+	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
+	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
+	flagSet.Parse(os.Args[2:])
+
+	// Set log level.
+	if err := logger.SetLevelFromString(logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flagSet.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read stat [--json] [--subvol path | --subvolid id] [-L] [-l level] <image> <path>")
+		os.Exit(1)
+	}
+
+	devicePath := flagSet.Arg(0)
+	filePath := flagSet.Arg(1)
+
+	// Open filesystem.
+	filesystem, err := openFilesystem(devicePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
+		os.Exit(1)
+	}
+	defer filesystem.Close()
+	filesystem = selectSubvolume(filesystem)
+
+	// Read inode. Like stat(1), a symlink is reported as itself unless -L
+	// is given.
+	var info *fs.InodeInfo
+	if dereference {
+		info, err = filesystem.Stat(filePath)
+	} else {
+		info, err = filesystem.Lstat(filePath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading inode: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		// JSON output format.
+		output := map[string]interface{}{
+			"path":       filePath,
+			"type":       getInodeTypeName(info.Mode),
+			"flag_names": getInodeFlagNames(info.Flags),
+			"inode":      info,
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		// Plain text output.
+		const timeFormat = "2006-01-02 15:04:05.000000000 -0700"
+
+		fmt.Printf("=== Btrfs Inode ===\n")
+		fmt.Printf("Device: %s\n", devicePath)
+		fmt.Printf("File:   %s\n\n", filePath)
+		fmt.Printf("Inode:       %d\n", info.Ino)
+		fmt.Printf("Type:        %s\n", getInodeTypeName(info.Mode))
+		fmt.Printf("Mode:        %04o (%s)\n", info.Mode&07777, info.FileMode())
+		fmt.Printf("Size:        %d\n", info.Size)
+		fmt.Printf("Disk Bytes:  %d\n", info.NBytes)
+		fmt.Printf("Links:       %d\n", info.NLink)
+		fmt.Printf("Uid:         %d\n", info.UID)
+		fmt.Printf("Gid:         %d\n", info.GID)
+		if info.RDev != 0 {
+			fmt.Printf("Device:      %d,%d\n", info.RDev>>20, info.RDev&0xfffff)
+		}
+		flags := getInodeFlagNames(info.Flags)
+		if len(flags) == 0 {
+			fmt.Printf("Flags:       0x%x\n", info.Flags)
+		} else {
+			fmt.Printf("Flags:       0x%x (%s)\n", info.Flags, strings.Join(flags, "|"))
+		}
+		fmt.Printf("Generation:  %d\n", info.Generation)
+		fmt.Printf("Transid:     %d\n", info.TransID)
+		fmt.Printf("Sequence:    %d\n", info.Sequence)
+		fmt.Printf("Block Group: %d\n", info.BlockGroup)
+		fmt.Printf("Access:      %s\n", info.ATime.Time().Format(timeFormat))
+		fmt.Printf("Modify:      %s\n", info.MTime.Time().Format(timeFormat))
+		fmt.Printf("Change:      %s\n", info.CTime.Time().Format(timeFormat))
+		fmt.Printf("Birth:       %s\n", info.OTime.Time().Format(timeFormat))
 	}
 }
 
-func printSuperblockInfo(sb *ondisk.Superblock) {
-	fmt.Println("=== Superblock Information ===")
-	fmt.Println()
+func cmdReadlink() {
+	flagSet := flag.NewFlagSet("readlink", flag.ExitOnError)
+	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	addSubvolumeFlags(flagSet)
+	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
+	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
+	flagSet.Parse(os.Args[2:])
 
-	// Magic number.
-	fmt.Printf("Magic:           %s", string(sb.Magic[:]))
-	if sb.IsValid() {
-		fmt.Println(" ✓")
+	// Set log level.
+	if err := logger.SetLevelFromString(logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flagSet.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read readlink [--json] [--subvol path | --subvolid id] [-l level] <image> <path>")
+		os.Exit(1)
+	}
+
+	devicePath := flagSet.Arg(0)
+	linkPath := flagSet.Arg(1)
+
+	// Open filesystem.
+	filesystem, err := openFilesystem(devicePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
+		os.Exit(1)
+	}
+	defer filesystem.Close()
+	filesystem = selectSubvolume(filesystem)
+
+	target, err := filesystem.Readlink(linkPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading link: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		// JSON output format.
+		output := map[string]interface{}{
+			"path":   linkPath,
+			"target": target,
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
 	} else {
-		fmt.Println(" ✗ INVALID")
+		// Plain text output, like readlink(1).
+		fmt.Println(target)
 	}
+}
 
-	// Basic information.
-	fmt.Printf("Label:           %s\n", sb.GetLabel())
-	fmt.Printf("FSID:            %s\n", formatUUID(sb.FSID[:]))
-	fmt.Printf("Metadata UUID:   %s\n", formatUUID(sb.MetadataUUID[:]))
+func cmdGetfattr() {
+	flagSet := flag.NewFlagSet("getfattr", flag.ExitOnError)
+	var attrName, encoding string
+	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	addSubvolumeFlags(flagSet)
+	flagSet.StringVar(&attrName, "n", "", "Dump only the named attribute")
+	flagSet.StringVar(&encoding, "e", "", "Value encoding: text, hex or base64")
+	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
+	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
+	flagSet.Parse(os.Args[2:])
 
-	// Size information.
-	fmt.Printf("Total Bytes:     %d (%.2f MB)\n", sb.TotalBytes, float64(sb.TotalBytes)/1024/1024)
-	fmt.Printf("Bytes Used:      %d (%.2f MB)\n", sb.BytesUsed, float64(sb.BytesUsed)/1024/1024)
-	fmt.Printf("Usage:           %.2f%%\n", float64(sb.BytesUsed)/float64(sb.TotalBytes)*100)
+	// Set log level.
+	if err := logger.SetLevelFromString(logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	// Node sizes.
-	fmt.Printf("Sector Size:     %d bytes\n", sb.SectorSize)
-	fmt.Printf("Node Size:       %d bytes\n", sb.NodeSize)
-	fmt.Printf("Leaf Size:       %d bytes\n", sb.LeafSize)
-	fmt.Printf("Stripe Size:     %d bytes\n", sb.StripeSize)
+	if flagSet.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read getfattr [--json] [--subvol path | --subvolid id] [-n name] [-e text|hex|base64] [-l level] <image> <path>")
+		os.Exit(1)
+	}
 
-	// Generations.
-	fmt.Printf("Generation:      %d\n", sb.Generation)
-	fmt.Printf("Chunk Root Gen:  %d\n", sb.ChunkRootGeneration)
+	switch encoding {
+	case "", "text", "hex", "base64":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown encoding %q\n", encoding)
+		os.Exit(1)
+	}
 
-	// Tree root addresses.
-	fmt.Printf("\n--- Tree Roots ---\n")
-	fmt.Printf("Root Tree:       0x%x (level %d)\n", sb.Root, sb.RootLevel)
-	fmt.Printf("Chunk Tree:      0x%x (level %d)\n", sb.ChunkRoot, sb.ChunkRootLevel)
-	if sb.LogRoot != 0 {
-		fmt.Printf("Log Tree:        0x%x (level %d)\n", sb.LogRoot, sb.LogRootLevel)
+	devicePath := flagSet.Arg(0)
+	filePath := flagSet.Arg(1)
+
+	// Open filesystem.
+	filesystem, err := openFilesystem(devicePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
+		os.Exit(1)
 	}
+	defer filesystem.Close()
+	filesystem = selectSubvolume(filesystem)
 
-	// Device information.
-	fmt.Printf("\n--- Device Information ---\n")
-	fmt.Printf("Num Devices:     %d\n", sb.NumDevices)
-	fmt.Printf("Device ID:       %d\n", sb.DevItem.DevID)
-	fmt.Printf("Device UUID:     %s\n", formatUUID(sb.DevItem.UUID[:]))
-	fmt.Printf("Device Total:    %d bytes\n", sb.DevItem.TotalBytes)
-	fmt.Printf("Device Used:     %d bytes\n", sb.DevItem.BytesUsed)
+	var xattrs []fs.Xattr
+	if attrName != "" {
+		value, err := filesystem.GetXattr(filePath, attrName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading attribute: %v\n", err)
+			os.Exit(1)
+		}
+		xattrs = []fs.Xattr{{Name: attrName, Value: value}}
+	} else {
+		xattrs, err = filesystem.ListXattrs(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing attributes: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Checksum type.
-	fmt.Printf("\n--- Features ---\n")
-	fmt.Printf("Checksum Type:   %s\n", getChecksumTypeName(sb.CsumType))
-	fmt.Printf("Compat Flags:    0x%x\n", sb.CompatFlags)
-	fmt.Printf("Incompat Flags:  0x%x\n", sb.IncompatFlags)
+	if jsonOutput {
+		// JSON output format; values are base64 encoded.
+		output := map[string]interface{}{
+			"path":   filePath,
+			"xattrs": xattrs,
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		// Plain text output, like getfattr -d.
+		fmt.Printf("# file: %s\n", filePath)
+		for _, x := range xattrs {
+			fmt.Printf("%s=%s\n", x.Name, formatXattrValue(x.Value, encoding))
+		}
+	}
+}
 
-	// System chunk array.
-	fmt.Printf("\n--- System Chunk Array ---\n")
-	fmt.Printf("Array Size:      %d bytes\n", sb.SysChunkArraySize)
-	if sb.SysChunkArraySize > 0 {
-		fmt.Printf("Array Data:      %s...\n", hex.EncodeToString(sb.SysChunkArray[:min(32, int(sb.SysChunkArraySize))]))
+// formatXattrValue encodes a value the way getfattr -e does. Without an
+// explicit encoding, printable values are quoted and others use base64.
+func formatXattrValue(value []byte, encoding string) string {
+	if encoding == "" {
+		encoding = "base64"
+		if isPrintable(value) {
+			encoding = "text"
+		}
 	}
 
-	fmt.Println()
+	switch encoding {
+	case "text":
+		return strconv.Quote(string(value))
+	case "hex":
+		return "0x" + hex.EncodeToString(value)
+	default:
+		return "0s" + base64.StdEncoding.EncodeToString(value)
+	}
+}
+
+// isPrintable reports whether value is text without control characters.
+// A single trailing NUL, as written by many tools, is allowed.
+func isPrintable(value []byte) bool {
+	if n := len(value); n > 0 && value[n-1] == 0 {
+		value = value[:n-1]
+	}
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func cmdGetfacl() {
+	flagSet := flag.NewFlagSet("getfacl", flag.ExitOnError)
+	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	addSubvolumeFlags(flagSet)
+	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
+	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
+	flagSet.Parse(os.Args[2:])
+
+	// Set log level.
+	if err := logger.SetLevelFromString(logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flagSet.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read getfacl [--json] [--subvol path | --subvolid id] [-l level] <image> <path>")
+		os.Exit(1)
+	}
+
+	devicePath := flagSet.Arg(0)
+	filePath := flagSet.Arg(1)
+
+	// Open filesystem.
+	filesystem, err := openFilesystem(devicePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
+		os.Exit(1)
+	}
+	defer filesystem.Close()
+	filesystem = selectSubvolume(filesystem)
+
+	inodeInfo, err := filesystem.Stat(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting file info: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Without an access ACL the permission bits are the ACL.
+	access, err := filesystem.GetACL(filePath, false)
+	if errors.Is(err, errors.ErrXattrNotFound) {
+		access = aclFromMode(inodeInfo.Mode)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading ACL: %v\n", err)
+		os.Exit(1)
+	}
+
+	defaults, err := filesystem.GetACL(filePath, true)
+	if err != nil && !errors.Is(err, errors.ErrXattrNotFound) {
+		fmt.Fprintf(os.Stderr, "Error reading default ACL: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		// JSON output format.
+		output := map[string]interface{}{
+			"path":    filePath,
+			"owner":   inodeInfo.UID,
+			"group":   inodeInfo.GID,
+			"access":  aclStrings(access),
+			"default": aclStrings(defaults),
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		// Plain text output, like getfacl(1).
+		fmt.Printf("# file: %s\n", filePath)
+		fmt.Printf("# owner: %d\n", inodeInfo.UID)
+		fmt.Printf("# group: %d\n", inodeInfo.GID)
+		printACL(access, "")
+		printACL(defaults, "default:")
+	}
+}
+
+// aclFromMode builds the minimal ACL equivalent to the permission bits.
+func aclFromMode(mode uint32) []fs.ACLEntry {
+	return []fs.ACLEntry{
+		{Tag: fs.ACLUserObj, Perm: uint16(mode>>6) & 7},
+		{Tag: fs.ACLGroupObj, Perm: uint16(mode>>3) & 7},
+		{Tag: fs.ACLOther, Perm: uint16(mode) & 7},
+	}
+}
+
+// aclStrings formats ACL entries in getfacl notation.
+func aclStrings(entries []fs.ACLEntry) []string {
+	result := make([]string, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e.String())
+	}
+	return result
+}
+
+// printACL prints ACL entries, adding the effective permissions where the
+// mask entry takes some away.
+func printACL(entries []fs.ACLEntry, prefix string) {
+	mask, hasMask := uint16(7), false
+	for _, e := range entries {
+		if e.Tag == fs.ACLMask {
+			mask, hasMask = e.Perm, true
+		}
+	}
+
+	for _, e := range entries {
+		masked := e.Tag == fs.ACLUser || e.Tag == fs.ACLGroupObj || e.Tag == fs.ACLGroup
+		if hasMask && masked && e.Perm&^mask != 0 {
+			fmt.Printf("%s%s\t#effective:%s\n", prefix, e, fs.FormatACLPerm(e.Perm&mask))
+		} else {
+			fmt.Printf("%s%s\n", prefix, e)
+		}
+	}
+}
+
+func cmdSubvolume() {
+	if len(os.Args) < 3 || os.Args[2] != "list" {
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read subvolume list [--json] [-s] [-r] [-l level] <image>")
+		os.Exit(1)
+	}
+
+	var snapshotsOnly, readonlyOnly bool
+
+	flagSet := flag.NewFlagSet("subvolume list", flag.ExitOnError)
+	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	flagSet.BoolVar(&snapshotsOnly, "s", false, "List only snapshots")
+	flagSet.BoolVar(&readonlyOnly, "r", false, "List only read-only subvolumes")
+	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
+	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
+	flagSet.Parse(os.Args[3:])
+
+	// Set log level.
+	if err := logger.SetLevelFromString(logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flagSet.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read subvolume list [--json] [-s] [-r] [-l level] <image>")
+		os.Exit(1)
+	}
+
+	devicePath := flagSet.Arg(0)
+
+	// Open filesystem.
+	filesystem, err := openFilesystem(devicePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
+		os.Exit(1)
+	}
+	defer filesystem.Close()
+
+	all, err := filesystem.ListSubvolumes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing subvolumes: %v\n", err)
+		os.Exit(1)
+	}
+
+	subvols := make([]*fs.Subvolume, 0, len(all))
+	for _, sv := range all {
+		if (snapshotsOnly && !sv.IsSnapshot()) || (readonlyOnly && !sv.Readonly) {
+			continue
+		}
+		subvols = append(subvols, sv)
+	}
+
+	if jsonOutput {
+		// JSON output format.
+		output := map[string]interface{}{
+			"subvolumes": subvols,
+			"count":      len(subvols),
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		// Plain text output, like btrfs subvolume list -pcouqR.
+		const timeFormat = "2006-01-02 15:04:05"
+
+		for _, sv := range subvols {
+			flags := "-"
+			if sv.Readonly {
+				flags = "readonly"
+			}
+			fmt.Printf("ID %d gen %d cgen %d parent %d top level %d otime %s parent_uuid %s received_uuid %s uuid %s flags %s path %s\n",
+				sv.ID, sv.Generation, sv.OTransID, sv.ParentID, sv.ParentID,
+				sv.OTime.Time().Format(timeFormat),
+				formatOptionalUUID(sv.ParentUUID), formatOptionalUUID(sv.ReceivedUUID),
+				formatOptionalUUID(sv.UUID), flags, sv.Path)
+		}
+	}
+}
+
+func cmdScan() {
+	flagSet := flag.NewFlagSet("scan", flag.ExitOnError)
+	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
+	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
+	flagSet.Parse(os.Args[2:])
+
+	// Set log level.
+	if err := logger.SetLevelFromString(logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flagSet.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: btrfs-read scan [--json] <file|directory|glob>...")
+		os.Exit(1)
+	}
+
+	groups, err := device.Scan(flagSet.Args()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning devices: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		// JSON output format.
+		output := map[string]interface{}{
+			"filesystems": groups,
+			"count":       len(groups),
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+
+	// Plain text output, like btrfs filesystem show.
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Println()
+		}
+		label := "none"
+		if g.Label != "" {
+			label = "'" + g.Label + "'"
+		}
+		fmt.Printf("Label: %s  uuid: %s\n", label, g.FSID)
+		fmt.Printf("\tTotal devices %d, found %d, generation %d\n", g.NumDevices, g.Found(), g.Generation)
+		for _, d := range g.Devices {
+			note := ""
+			if d.Stale {
+				note = fmt.Sprintf(" (stale, generation %d)", d.Generation)
+			}
+			if d.Duplicate {
+				note += " (duplicate)"
+			}
+			fmt.Printf("\tdevid %4d size %d used %d uuid %s path %s%s\n",
+				d.DevID, d.TotalBytes, d.BytesUsed, d.DevUUID, d.Path, note)
+		}
+		if !g.Complete {
+			fmt.Printf("\t*** Some devices missing (%d)\n", g.Missing())
+		}
+	}
+}
+
+func cmdDevice() {
+	const usage = "Usage: btrfs-read device stats [--json] [-c] [-l level] <image>"
+	if len(os.Args) < 3 || os.Args[2] != "stats" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	var check bool
+
+	flagSet := flag.NewFlagSet("device stats", flag.ExitOnError)
+	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	flagSet.BoolVar(&check, "c", false, "Exit with status 64 if any error counter is not zero")
+	flagSet.BoolVar(&check, "check", false, "Exit with status 64 if any error counter is not zero")
+	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
+	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
+	flagSet.Parse(os.Args[3:])
+
+	// Set log level.
+	if err := logger.SetLevelFromString(logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flagSet.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	// Open filesystem.
+	filesystem, err := openFilesystem(flagSet.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
+		os.Exit(1)
+	}
+	defer filesystem.Close()
+
+	devices, err := filesystem.ListDevices()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing devices: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		// JSON output format.
+		output := map[string]interface{}{
+			"devices": devices,
+			"count":   len(devices),
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		// Plain text output, like btrfs device stats.
+		for _, d := range devices {
+			name := d.Path
+			if d.Missing {
+				name = fmt.Sprintf("devid:%d", d.DevID)
+			}
+			fmt.Printf("[%s].write_io_errs    %d\n", name, d.Stats.WriteErrs)
+			fmt.Printf("[%s].read_io_errs     %d\n", name, d.Stats.ReadErrs)
+			fmt.Printf("[%s].flush_io_errs    %d\n", name, d.Stats.FlushErrs)
+			fmt.Printf("[%s].corruption_errs  %d\n", name, d.Stats.CorruptionErrs)
+			fmt.Printf("[%s].generation_errs  %d\n", name, d.Stats.GenerationErrs)
+		}
+	}
+
+	if check {
+		for _, d := range devices {
+			if d.Stats.Total() > 0 {
+				os.Exit(64)
+			}
+		}
+	}
+}
+
+func cmdPhysicalToLogical() {
+	const usage = "Usage: btrfs-read physical-to-logical [--json] [--devid <id>] [--lba] [-l level] <image> <offset>"
+	var devID uint64
+	var lba bool
+
+	flagSet := flag.NewFlagSet("physical-to-logical", flag.ExitOnError)
+	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	flagSet.Uint64Var(&devID, "devid", 0, "Device ID of the offset (default: the device of <image>)")
+	flagSet.BoolVar(&lba, "lba", false, "The offset is a 512-byte sector number")
+	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
+	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
+	flagSet.Parse(os.Args[2:])
+
+	// Set log level.
+	if err := logger.SetLevelFromString(logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flagSet.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	devicePath := flagSet.Arg(0)
+	physical, err := strconv.ParseUint(flagSet.Arg(1), 0, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid offset %q: %v\n", flagSet.Arg(1), err)
+		os.Exit(1)
+	}
+	if lba {
+		physical *= 512
+	}
+
+	// Open filesystem.
+	filesystem, err := openFilesystem(devicePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
+		os.Exit(1)
+	}
+	defer filesystem.Close()
+
+	if devID == 0 {
+		devices, err := filesystem.ListDevices()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing devices: %v\n", err)
+			os.Exit(1)
+		}
+		for _, d := range devices {
+			if d.Path == devicePath {
+				devID = d.DevID
+			}
+		}
+		if devID == 0 {
+			fmt.Fprintf(os.Stderr, "Error: %s is not a member of the filesystem, use --devid\n", devicePath)
+			os.Exit(1)
+		}
+	}
+
+	addr, err := filesystem.PhysicalToLogical(devID, physical)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		// JSON output format.
+		output := map[string]interface{}{
+			"devid":       devID,
+			"physical":    physical,
+			"logical":     addr.Logical,
+			"chunk_start": addr.ChunkStart,
+			"chunk_type":  ondisk.FormatBlockGroupType(addr.Type),
+			"stripe":      addr.Stripe,
+			"mirror":      addr.Mirror,
+			"parity":      addr.Parity,
+		}
+		if addr.Parity > 0 {
+			output["protects"] = addr.Protects
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+
+	// Plain text output.
+	fmt.Printf("device %d offset 0x%x (LBA %d)\n", devID, physical, physical/512)
+	chunkDesc := fmt.Sprintf("%s chunk 0x%x, stripe %d", ondisk.FormatBlockGroupType(addr.Type), addr.ChunkStart, addr.Stripe)
+	if addr.Parity > 0 {
+		name := "P"
+		if addr.Parity == 2 {
+			name = "Q"
+		}
+		fmt.Printf("%s parity in %s\n", name, chunkDesc)
+		for _, logical := range addr.Protects {
+			fmt.Printf("  protects logical 0x%x\n", logical)
+		}
+		return
+	}
+	fmt.Printf("logical 0x%x, copy %d in %s\n", addr.Logical, addr.Mirror+1, chunkDesc)
+}
+
+func cmdLogicalResolve() {
+	const usage = "Usage: btrfs-read logical-resolve [--json] [-P] [-l level] <image> <logical>"
+	var noPaths bool
+
+	flagSet := flag.NewFlagSet("logical-resolve", flag.ExitOnError)
+	flagSet.BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	addOpenFlags(flagSet)
+	flagSet.BoolVar(&noPaths, "P", false, "Print inode numbers, offsets and roots instead of paths")
+	flagSet.StringVar(&logLevel, "log-level", "info", "Log level")
+	flagSet.StringVar(&logLevel, "l", "info", "Log level (shorthand)")
+	flagSet.Parse(os.Args[2:])
+
+	// Set log level.
+	if err := logger.SetLevelFromString(logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flagSet.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	devicePath := flagSet.Arg(0)
+	logical, err := strconv.ParseUint(flagSet.Arg(1), 0, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid logical address %q: %v\n", flagSet.Arg(1), err)
+		os.Exit(1)
+	}
+
+	// Open filesystem.
+	filesystem, err := openFilesystem(devicePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening filesystem: %v\n", err)
+		os.Exit(1)
+	}
+	defer filesystem.Close()
+
+	inodes, err := filesystem.LogicalResolve(logical)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		// JSON output format.
+		output := map[string]interface{}{
+			"logical": logical,
+			"inodes":  inodes,
+			"count":   len(inodes),
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+
+	// Plain text output: one path per line, like btrfs inspect-internal
+	// logical-resolve, or the inode when its path is unknown.
+	if len(inodes) == 0 {
+		fmt.Fprintf(os.Stderr, "No file references logical 0x%x\n", logical)
+	}
+	for _, inode := range inodes {
+		if noPaths || len(inode.Paths) == 0 {
+			fmt.Printf("inode %d offset %d root %d\n", inode.Inode, inode.Offset, inode.Root)
+			continue
+		}
+		for _, path := range inode.Paths {
+			fmt.Println(path)
+		}
+	}
+}
+
+// formatOptionalUUID formats a UUID, or "-" if it is unset.
+func formatOptionalUUID(uuid ondisk.UUID) string {
+	if uuid.IsZero() {
+		return "-"
+	}
+	return uuid.String()
+}
+
+// addOpenFlags registers the flags that control how the filesystem is opened.
+func addOpenFlags(flagSet *flag.FlagSet) {
+	flagSet.IntVar(&backupRoot, "backup-root", 0, "Try at most this many superblock backup roots, newest first, if the current tree roots are damaged (a count, not a slot)")
+	flagSet.Var(&devicePaths, "device", "Another member device of a multi-device filesystem (repeatable)")
+}
+
+// openFilesystem opens the image, and the other members given with
+// --device, with the options chosen on the command line. It reports on
+// stderr when a backup root had to be used or members are missing.
+func openFilesystem(devicePath string) (*fs.FileSystem, error) {
+	paths := append([]string{devicePath}, devicePaths...)
+	filesystem, err := fs.OpenDevicesWithOptions(paths, fs.OpenOptions{UseBackupRoot: backupRoot})
+	if err != nil {
+		return nil, err
+	}
+	if missing := filesystem.MissingDevices(); len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d of %d devices missing (device IDs %v), reading from the remaining copies\n",
+			len(missing), filesystem.NumDevices(), missing)
+	}
+	if slot := filesystem.BackupRoot(); slot >= 0 {
+		fmt.Fprintf(os.Stderr, "Warning: current tree roots are damaged, using backup root %d\n", slot)
+	}
+	return filesystem, nil
+}
+
+// addSubvolumeFlags registers the flags that select the subvolume to browse.
+func addSubvolumeFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&subvolPath, "subvol", "", "Browse the subvolume at this path from the top level")
+	flagSet.Uint64Var(&subvolID, "subvolid", 0, "Browse the subvolume with this ID")
+}
+
+// selectSubvolume switches to the subvolume chosen with --subvol or
+// --subvolid. Without either, the default subvolume opened by fs.Open is
+// kept.
+func selectSubvolume(filesystem *fs.FileSystem) *fs.FileSystem {
+	var err error
+	switch {
+	case subvolPath != "" && subvolID != 0:
+		err = fmt.Errorf("--subvol and --subvolid are mutually exclusive")
+	case subvolPath != "":
+		filesystem, err = filesystem.OpenSubvolumeByPath(subvolPath)
+	case subvolID != 0:
+		filesystem, err = filesystem.OpenSubvolume(subvolID)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening subvolume: %v\n", err)
+		os.Exit(1)
+	}
+	return filesystem
+}
+
+// getInodeTypeName returns the file type encoded in an inode mode.
+func getInodeTypeName(mode uint32) string {
+	switch mode & ondisk.ModeTypeMask {
+	case ondisk.ModeRegular:
+		return "file"
+	case ondisk.ModeDir:
+		return "dir"
+	case ondisk.ModeCharDev:
+		return "chrdev"
+	case ondisk.ModeBlockDev:
+		return "blkdev"
+	case ondisk.ModeFifo:
+		return "fifo"
+	case ondisk.ModeSocket:
+		return "sock"
+	case ondisk.ModeSymlink:
+		return "symlink"
+	default:
+		return "unknown"
+	}
+}
+
+// getInodeFlagNames returns the names of the inode flags that are set.
+func getInodeFlagNames(flags uint64) []string {
+	names := []struct {
+		flag uint64
+		name string
+	}{
+		{ondisk.InodeNodatasum, "NODATASUM"},
+		{ondisk.InodeNodatacow, "NODATACOW"},
+		{ondisk.InodeReadonly, "READONLY"},
+		{ondisk.InodeNocompress, "NOCOMPRESS"},
+		{ondisk.InodePrealloc, "PREALLOC"},
+		{ondisk.InodeSync, "SYNC"},
+		{ondisk.InodeImmutable, "IMMUTABLE"},
+		{ondisk.InodeAppend, "APPEND"},
+		{ondisk.InodeNodump, "NODUMP"},
+		{ondisk.InodeNoatime, "NOATIME"},
+		{ondisk.InodeDirsync, "DIRSYNC"},
+		{ondisk.InodeCompress, "COMPRESS"},
+	}
+
+	result := make([]string, 0)
+	for _, n := range names {
+		if flags&n.flag != 0 {
+			result = append(result, n.name)
+		}
+	}
+	return result
+}
+
+func getFileTypeName(fileType uint8) string {
+	switch fileType {
+	case 1:
+		return "file"
+	case 2:
+		return "dir"
+	case 3:
+		return "chrdev"
+	case 4:
+		return "blkdev"
+	case 5:
+		return "fifo"
+	case 6:
+		return "sock"
+	case 7:
+		return "symlink"
+	default:
+		return "unknown"
+	}
+}
+
+func printSuperblockInfo(sb *ondisk.Superblock) {
+	fmt.Println("=== Superblock Information ===")
+	fmt.Println()
+
+	// Magic number.
+	fmt.Printf("Magic:           %s", string(sb.Magic[:]))
+	if sb.IsValid() {
+		fmt.Println(" ✓")
+	} else {
+		fmt.Println(" ✗ INVALID")
+	}
+
+	// Basic information.
+	fmt.Printf("Label:           %s\n", sb.GetLabel())
+	fmt.Printf("FSID:            %s\n", formatUUID(sb.FSID[:]))
+	fmt.Printf("Metadata UUID:   %s\n", formatUUID(sb.MetadataUUID[:]))
+
+	// Size information.
+	fmt.Printf("Total Bytes:     %d (%.2f MB)\n", sb.TotalBytes, float64(sb.TotalBytes)/1024/1024)
+	fmt.Printf("Bytes Used:      %d (%.2f MB)\n", sb.BytesUsed, float64(sb.BytesUsed)/1024/1024)
+	fmt.Printf("Usage:           %.2f%%\n", float64(sb.BytesUsed)/float64(sb.TotalBytes)*100)
+
+	// Node sizes.
+	fmt.Printf("Sector Size:     %d bytes\n", sb.SectorSize)
+	fmt.Printf("Node Size:       %d bytes\n", sb.NodeSize)
+	fmt.Printf("Leaf Size:       %d bytes\n", sb.LeafSize)
+	fmt.Printf("Stripe Size:     %d bytes\n", sb.StripeSize)
+
+	// Generations.
+	fmt.Printf("Generation:      %d\n", sb.Generation)
+	fmt.Printf("Chunk Root Gen:  %d\n", sb.ChunkRootGeneration)
+
+	// Tree root addresses.
+	fmt.Printf("\n--- Tree Roots ---\n")
+	fmt.Printf("Root Tree:       0x%x (level %d)\n", sb.Root, sb.RootLevel)
+	fmt.Printf("Chunk Tree:      0x%x (level %d)\n", sb.ChunkRoot, sb.ChunkRootLevel)
+	if sb.LogRoot != 0 {
+		fmt.Printf("Log Tree:        0x%x (level %d)\n", sb.LogRoot, sb.LogRootLevel)
+	}
+
+	// Device information.
+	fmt.Printf("\n--- Device Information ---\n")
+	fmt.Printf("Num Devices:     %d\n", sb.NumDevices)
+	fmt.Printf("Device ID:       %d\n", sb.DevItem.DevID)
+	fmt.Printf("Device UUID:     %s\n", formatUUID(sb.DevItem.UUID[:]))
+	fmt.Printf("Device Total:    %d bytes\n", sb.DevItem.TotalBytes)
+	fmt.Printf("Device Used:     %d bytes\n", sb.DevItem.BytesUsed)
+
+	// Checksum type.
+	fmt.Printf("\n--- Features ---\n")
+	fmt.Printf("Checksum Type:   %s\n", getChecksumTypeName(sb.CsumType))
+	fmt.Printf("Compat Flags:    %s\n", formatFlags(sb.CompatFlags, ondisk.FormatCompatFlags))
+	fmt.Printf("Compat RO Flags: %s\n", formatFlags(sb.CompatRoFlags, ondisk.FormatCompatRoFlags))
+	fmt.Printf("Incompat Flags:  %s\n", formatFlags(sb.IncompatFlags, ondisk.FormatIncompatFlags))
+
+	// System chunk array.
+	fmt.Printf("\n--- System Chunk Array ---\n")
+	fmt.Printf("Array Size:      %d bytes\n", sb.SysChunkArraySize)
+	if sb.SysChunkArraySize > 0 {
+		fmt.Printf("Array Data:      %s...\n", hex.EncodeToString(sb.SysChunkArray[:min(32, int(sb.SysChunkArraySize))]))
+	}
+
+	fmt.Println()
+}
+
+// printSuperblockFull prints every superblock field, in on-disk order, in
+// the style of "btrfs inspect-internal dump-super --full".
+func printSuperblockFull(sb *ondisk.Superblock) {
+	fmt.Println("=== Superblock (full) ===")
+	fmt.Println()
+
+	csumLen := ondisk.CsumSize(sb.CsumType)
+	if csumLen == 0 {
+		csumLen = ondisk.ChecksumSize
+	}
+	fmt.Printf("csum_type\t\t\t%d (%s)\n", sb.CsumType, ondisk.CsumName(sb.CsumType))
+	fmt.Printf("csum\t\t\t\t0x%x\n", sb.Checksum[:csumLen])
+	fmt.Printf("bytenr\t\t\t\t%d\n", sb.Bytenr)
+	fmt.Printf("flags\t\t\t\t%s\n", formatFlags(sb.Flags, ondisk.FormatSuperFlags))
+	fmt.Printf("magic\t\t\t\t%s\n", string(sb.Magic[:]))
+	fmt.Printf("fsid\t\t\t\t%s\n", formatUUID(sb.FSID[:]))
+	fmt.Printf("metadata_uuid\t\t\t%s\n", formatUUID(sb.MetadataUUID[:]))
+	fmt.Printf("label\t\t\t\t%s\n", sb.GetLabel())
+	fmt.Printf("generation\t\t\t%d\n", sb.Generation)
+	fmt.Printf("root\t\t\t\t%d\n", sb.Root)
+	fmt.Printf("sys_array_size\t\t\t%d\n", sb.SysChunkArraySize)
+	fmt.Printf("chunk_root_generation\t\t%d\n", sb.ChunkRootGeneration)
+	fmt.Printf("root_level\t\t\t%d\n", sb.RootLevel)
+	fmt.Printf("chunk_root\t\t\t%d\n", sb.ChunkRoot)
+	fmt.Printf("chunk_root_level\t\t%d\n", sb.ChunkRootLevel)
+	fmt.Printf("log_root\t\t\t%d\n", sb.LogRoot)
+	fmt.Printf("log_root_transid\t\t%d\n", sb.LogRootTransid)
+	fmt.Printf("log_root_level\t\t\t%d\n", sb.LogRootLevel)
+	fmt.Printf("block_group_root\t\t%d\n", sb.BlockGroupRoot)
+	fmt.Printf("block_group_root_generation\t%d\n", sb.BlockGroupRootGeneration)
+	fmt.Printf("block_group_root_level\t\t%d\n", sb.BlockGroupRootLevel)
+	fmt.Printf("total_bytes\t\t\t%d\n", sb.TotalBytes)
+	fmt.Printf("bytes_used\t\t\t%d\n", sb.BytesUsed)
+	fmt.Printf("sectorsize\t\t\t%d\n", sb.SectorSize)
+	fmt.Printf("nodesize\t\t\t%d\n", sb.NodeSize)
+	fmt.Printf("leafsize (deprecated)\t\t%d\n", sb.LeafSize)
+	fmt.Printf("stripesize\t\t\t%d\n", sb.StripeSize)
+	fmt.Printf("root_dir\t\t\t%d\n", sb.RootDirObjectid)
+	fmt.Printf("num_devices\t\t\t%d\n", sb.NumDevices)
+	fmt.Printf("compat_flags\t\t\t%s\n", formatFlags(sb.CompatFlags, ondisk.FormatCompatFlags))
+	fmt.Printf("compat_ro_flags\t\t\t%s\n", formatFlags(sb.CompatRoFlags, ondisk.FormatCompatRoFlags))
+	fmt.Printf("incompat_flags\t\t\t%s\n", formatFlags(sb.IncompatFlags, ondisk.FormatIncompatFlags))
+	fmt.Printf("cache_generation\t\t%d\n", sb.CacheGeneration)
+	fmt.Printf("uuid_tree_generation\t\t%d\n", sb.UUIDTreeGeneration)
+	fmt.Printf("nr_global_roots\t\t\t%d\n", sb.NrGlobalRoots)
+
+	di := sb.DevItem
+	fmt.Printf("dev_item.uuid\t\t\t%s\n", formatUUID(di.UUID[:]))
+	fmt.Printf("dev_item.fsid\t\t\t%s\n", formatUUID(di.FSID[:]))
+	fmt.Printf("dev_item.type\t\t\t%d\n", di.Type)
+	fmt.Printf("dev_item.total_bytes\t\t%d\n", di.TotalBytes)
+	fmt.Printf("dev_item.bytes_used\t\t%d\n", di.BytesUsed)
+	fmt.Printf("dev_item.io_align\t\t%d\n", di.IOAlign)
+	fmt.Printf("dev_item.io_width\t\t%d\n", di.IOWidth)
+	fmt.Printf("dev_item.sector_size\t\t%d\n", di.SectorSize)
+	fmt.Printf("dev_item.devid\t\t\t%d\n", di.DevID)
+	fmt.Printf("dev_item.dev_group\t\t%d\n", di.DevGroup)
+	fmt.Printf("dev_item.seek_speed\t\t%d\n", di.SeekSpeed)
+	fmt.Printf("dev_item.bandwidth\t\t%d\n", di.Bandwidth)
+	fmt.Printf("dev_item.generation\t\t%d\n", di.Generation)
+
+	fmt.Printf("\nbackup_roots[%d]:\n", ondisk.NumBackupRoots)
+	for i, rb := range sb.SuperRoots {
+		if rb.IsEmpty() {
+			fmt.Printf("\tbackup %d: empty\n", i)
+			continue
+		}
+		fmt.Printf("\tbackup %d:\n", i)
+		fmt.Printf("\t\tbackup_tree_root:\t%d\tgen: %d\tlevel: %d\n", rb.TreeRoot, rb.TreeRootGen, rb.TreeRootLevel)
+		fmt.Printf("\t\tbackup_chunk_root:\t%d\tgen: %d\tlevel: %d\n", rb.ChunkRoot, rb.ChunkRootGen, rb.ChunkRootLevel)
+		fmt.Printf("\t\tbackup_extent_root:\t%d\tgen: %d\tlevel: %d\n", rb.ExtentRoot, rb.ExtentRootGen, rb.ExtentRootLevel)
+		fmt.Printf("\t\tbackup_fs_root:\t\t%d\tgen: %d\tlevel: %d\n", rb.FSRoot, rb.FSRootGen, rb.FSRootLevel)
+		fmt.Printf("\t\tbackup_dev_root:\t%d\tgen: %d\tlevel: %d\n", rb.DevRoot, rb.DevRootGen, rb.DevRootLevel)
+		fmt.Printf("\t\tbackup_csum_root:\t%d\tgen: %d\tlevel: %d\n", rb.CsumRoot, rb.CsumRootGen, rb.CsumRootLevel)
+		fmt.Printf("\t\tbackup_total_bytes:\t%d\n", rb.TotalBytes)
+		fmt.Printf("\t\tbackup_bytes_used:\t%d\n", rb.BytesUsed)
+		fmt.Printf("\t\tbackup_num_devices:\t%d\n", rb.NumDevices)
+	}
+	fmt.Println()
+}
+
+// formatFlags shows a flag set in hex followed by its symbolic names.
+func formatFlags(flags uint64, names func(uint64) string) string {
+	if flags == 0 {
+		return "0x0"
+	}
+	return fmt.Sprintf("0x%x (%s)", flags, names(flags))
 }
 
 func formatUUID(uuid []byte) string {
@@ -3,6 +3,7 @@ module github.com/WinBeyond/btrfs-read
 go 1.21
 
 require (
+	github.com/cespare/xxhash/v2 v2.3.0
 	github.com/emirpasic/gods v1.18.1
 	github.com/hanwen/go-fuse/v2 v2.4.0
 	github.com/klauspost/compress v1.17.0
@@ -11,3 +12,5 @@ require (
 	golang.org/x/crypto v0.17.0
 	golang.org/x/sync v0.5.0
 )
+
+require golang.org/x/sys v0.15.0 // indirect
@@ -0,0 +1,156 @@
+package btree
+
+import (
+	"fmt"
+)
+
+// Cursor is a position in a B-Tree that can step forward and backward
+// through the items in key order. It moves between leaves using the parent
+// slots recorded in its Path, so stepping costs one node read per level
+// changed instead of a search from the root.
+//
+// A cursor can also sit just before the first item or just after the last
+// one; Item then returns nil, and Next or Prev steps back onto the tree.
+type Cursor struct {
+	searcher *Searcher
+	root     uint64
+	path     *Path
+}
+
+// NewCursor returns an unpositioned cursor over the tree at rootAddr.
+// Call Seek before using it.
+func (s *Searcher) NewCursor(rootAddr uint64) *Cursor {
+	return &Cursor{searcher: s, root: rootAddr}
+}
+
+// Seek positions the cursor at the first item with a key >= key. It
+// returns false, leaving the cursor after the last item, if there is none.
+func (c *Cursor) Seek(key *Key) (bool, error) {
+	path, err := c.searcher.Search(c.root, key)
+	if err != nil {
+		return false, err
+	}
+	c.path = path
+
+	// The search may stop past the last item of a leaf when the key sorts
+	// between two leaves; the next item is then in a following leaf.
+	if c.slot() < len(c.leaf().Items) {
+		return true, nil
+	}
+	c.setSlot(c.slot() - 1)
+	return c.Next()
+}
+
+// Item returns the item at the cursor, or nil if the cursor is not on an
+// item.
+func (c *Cursor) Item() *Item {
+	if c.path == nil {
+		return nil
+	}
+	slot := c.slot()
+	if slot < 0 || slot >= len(c.leaf().Items) {
+		return nil
+	}
+	return c.leaf().Items[slot]
+}
+
+// Next moves to the following item. It returns false, leaving the cursor
+// after the last item, when there is none.
+func (c *Cursor) Next() (bool, error) {
+	if c.path == nil {
+		return false, fmt.Errorf("cursor not positioned")
+	}
+
+	c.setSlot(c.slot() + 1)
+	for c.slot() >= len(c.leaf().Items) {
+		ok, err := c.searcher.nextLeaf(c.path)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			c.setSlot(len(c.leaf().Items))
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Prev moves to the preceding item. It returns false, leaving the cursor
+// before the first item, when there is none.
+func (c *Cursor) Prev() (bool, error) {
+	if c.path == nil {
+		return false, fmt.Errorf("cursor not positioned")
+	}
+
+	c.setSlot(c.slot() - 1)
+	for c.slot() < 0 {
+		ok, err := c.searcher.prevLeaf(c.path)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			c.setSlot(-1)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (c *Cursor) leaf() *Node {
+	return c.path.Nodes[len(c.path.Nodes)-1]
+}
+
+func (c *Cursor) slot() int {
+	return c.path.Slots[len(c.path.Slots)-1]
+}
+
+func (c *Cursor) setSlot(slot int) {
+	c.path.Slots[len(c.path.Slots)-1] = slot
+}
+
+// ScanRange calls fn for every item with minKey <= key <= maxKey in key
+// order, until fn returns false or an error.
+func (s *Searcher) ScanRange(rootAddr uint64, minKey, maxKey *Key, fn func(item *Item) (bool, error)) error {
+	return s.Walk(rootAddr, minKey, func(item *Item) (bool, error) {
+		if item.Key.Compare(maxKey) > 0 {
+			return false, nil
+		}
+		return fn(item)
+	})
+}
+
+// prevLeaf moves the path to the last slot of the previous leaf. It is the
+// mirror of nextLeaf and returns false when the path already points into
+// the first leaf of the tree.
+func (s *Searcher) prevLeaf(path *Path) (bool, error) {
+	for level := len(path.Nodes) - 2; level >= 0; level-- {
+		if path.Slots[level] == 0 {
+			continue
+		}
+
+		path.Slots[level]--
+		currentAddr := path.Nodes[level].Ptrs[path.Slots[level]]
+
+		// Descend along the rightmost edge of the previous subtree.
+		for l := level + 1; l < len(path.Nodes); l++ {
+			child, err := s.reader.ReadNode(currentAddr, s.nodeSize)
+			if err != nil {
+				return false, fmt.Errorf("failed to read node at 0x%x: %w", currentAddr, err)
+			}
+			path.Nodes[l] = child
+
+			if child.Header.IsLeaf() {
+				path.Slots[l] = len(child.Items) - 1
+				continue
+			}
+			if len(child.Ptrs) == 0 {
+				return false, fmt.Errorf("empty internal node at 0x%x", currentAddr)
+			}
+			path.Slots[l] = len(child.Ptrs) - 1
+			currentAddr = child.Ptrs[len(child.Ptrs)-1]
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
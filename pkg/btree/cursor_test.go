@@ -0,0 +1,116 @@
+package btree
+
+import (
+	"testing"
+)
+
+func TestCursorNextAndPrev(t *testing.T) {
+	r, root := buildTestTree(50, 3, 2)
+	s := NewSearcher(r, 4096)
+	c := s.NewCursor(root)
+
+	ok, err := c.Seek(&Key{ObjectID: 20, Type: 1})
+	if err != nil || !ok {
+		t.Fatalf("Seek = %v, %v", ok, err)
+	}
+
+	// Forward to the end of the tree, then all the way back.
+	for want := uint64(20); ; want++ {
+		if got := c.Item().Key.ObjectID; got != want {
+			t.Fatalf("forward: got key %d, want %d", got, want)
+		}
+		if ok, err = c.Next(); err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		if !ok {
+			if want != 49 {
+				t.Fatalf("Next stopped after key %d, want 49", want)
+			}
+			break
+		}
+	}
+	if c.Item() != nil {
+		t.Fatalf("Item after the last key = %v, want nil", c.Item().Key)
+	}
+
+	for want := int64(49); ; want-- {
+		if ok, err = c.Prev(); err != nil {
+			t.Fatalf("Prev failed: %v", err)
+		}
+		if !ok {
+			if want != -1 {
+				t.Fatalf("Prev stopped before key %d", want)
+			}
+			break
+		}
+		if got := c.Item().Key.ObjectID; got != uint64(want) {
+			t.Fatalf("backward: got key %d, want %d", got, want)
+		}
+	}
+	if c.Item() != nil {
+		t.Fatalf("Item before the first key = %v, want nil", c.Item().Key)
+	}
+
+	// Stepping forward again from before the start lands on the first key.
+	if ok, err = c.Next(); err != nil || !ok || c.Item().Key.ObjectID != 0 {
+		t.Fatalf("Next from the start = %v, %v", ok, err)
+	}
+}
+
+func TestCursorSeek(t *testing.T) {
+	r, root := buildTestTree(12, 4, 4)
+	s := NewSearcher(r, 4096)
+	c := s.NewCursor(root)
+
+	if _, err := c.Next(); err == nil {
+		t.Error("Next on an unpositioned cursor should fail")
+	}
+
+	// (3, 2, 0) sorts between the first and the second leaf.
+	ok, err := c.Seek(&Key{ObjectID: 3, Type: 2})
+	if err != nil || !ok || c.Item().Key.ObjectID != 4 {
+		t.Fatalf("Seek between leaves = %v, %v", ok, err)
+	}
+	if ok, err = c.Prev(); err != nil || !ok || c.Item().Key.ObjectID != 3 {
+		t.Fatalf("Prev across the leaf boundary = %v, %v", ok, err)
+	}
+
+	// Past the last key the cursor is at the end, and Prev returns the
+	// last item.
+	ok, err = c.Seek(&Key{ObjectID: 100})
+	if err != nil || ok {
+		t.Fatalf("Seek past the end = %v, %v", ok, err)
+	}
+	if ok, err = c.Prev(); err != nil || !ok || c.Item().Key.ObjectID != 11 {
+		t.Fatalf("Prev from the end = %v, %v", ok, err)
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	r, root := buildTestTree(100, 5, 3)
+	s := NewSearcher(r, 4096)
+
+	var got []uint64
+	err := s.ScanRange(root, &Key{ObjectID: 13}, &Key{ObjectID: 42, Type: 1}, func(item *Item) (bool, error) {
+		got = append(got, item.Key.ObjectID)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("ScanRange failed: %v", err)
+	}
+	if len(got) != 30 || got[0] != 13 || got[len(got)-1] != 42 {
+		t.Fatalf("ScanRange visited %v, want keys 13..42", got)
+	}
+
+	// Stopping at maxKey must not read the rest of the tree.
+	r.reads = 0
+	err = s.ScanRange(root, &Key{}, &Key{ObjectID: 2, Type: 1}, func(item *Item) (bool, error) {
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("ScanRange failed: %v", err)
+	}
+	if r.reads > 10 {
+		t.Errorf("ScanRange of the first leaf read %d nodes", r.reads)
+	}
+}
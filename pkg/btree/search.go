@@ -47,11 +47,13 @@ func (s *Searcher) Search(rootAddr uint64, targetKey *Key) (*Path, error) {
 		}
 
 		// Binary search.
-		slot, exact := s.binarySearch(node, targetKey)
+		slot, _ := s.binarySearch(node, targetKey)
 
-		// For internal nodes, if not exact match, use the previous slot.
+		// For internal nodes the search returns the first key > target, so
+		// the child covering the target is always the previous slot (this
+		// also holds for an exact match, which lives at slot-1).
 		// See btrfs-fuse: if (level && ret && slot > 0) slot--;
-		if !node.Header.IsLeaf() && !exact && slot > 0 {
+		if !node.Header.IsLeaf() && slot > 0 {
 			slot--
 		}
 
@@ -71,6 +73,56 @@ func (s *Searcher) Search(rootAddr uint64, targetKey *Key) (*Path, error) {
 	}
 }
 
+// Walk visits items in key order starting at the first key >= start.
+// It keeps calling fn across leaf boundaries until fn returns false,
+// fn returns an error, or the tree is exhausted.
+func (s *Searcher) Walk(rootAddr uint64, start *Key, fn func(item *Item) (bool, error)) error {
+	c := s.NewCursor(rootAddr)
+	ok, err := c.Seek(start)
+	for ; ok && err == nil; ok, err = c.Next() {
+		cont, err := fn(c.Item())
+		if err != nil || !cont {
+			return err
+		}
+	}
+	return err
+}
+
+// nextLeaf moves the path to the first slot of the next leaf.
+// It climbs using the parent slots recorded in the path and returns false
+// when the path already points into the last leaf of the tree.
+func (s *Searcher) nextLeaf(path *Path) (bool, error) {
+	for level := len(path.Nodes) - 2; level >= 0; level-- {
+		node := path.Nodes[level]
+		if path.Slots[level]+1 >= len(node.Ptrs) {
+			continue
+		}
+
+		path.Slots[level]++
+		currentAddr := node.Ptrs[path.Slots[level]]
+
+		// Descend along the leftmost edge of the next subtree.
+		for l := level + 1; l < len(path.Nodes); l++ {
+			child, err := s.reader.ReadNode(currentAddr, s.nodeSize)
+			if err != nil {
+				return false, fmt.Errorf("failed to read node at 0x%x: %w", currentAddr, err)
+			}
+			path.Nodes[l] = child
+			path.Slots[l] = 0
+
+			if !child.Header.IsLeaf() {
+				if len(child.Ptrs) == 0 {
+					return false, fmt.Errorf("empty internal node at 0x%x", currentAddr)
+				}
+				currentAddr = child.Ptrs[0]
+			}
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
 // binarySearch performs binary search, returning (slot, exact_match).
 func (s *Searcher) binarySearch(node *Node, targetKey *Key) (int, bool) {
 	if node.Header.IsLeaf() {
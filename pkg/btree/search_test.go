@@ -0,0 +1,146 @@
+package btree
+
+import (
+	"fmt"
+	"testing"
+)
+
+// memReader serves nodes from memory.
+type memReader struct {
+	nodes map[uint64]*Node
+	reads int
+}
+
+func (r *memReader) ReadNode(logical uint64, nodeSize uint32) (*Node, error) {
+	r.reads++
+	node, ok := r.nodes[logical]
+	if !ok {
+		return nil, fmt.Errorf("no node at 0x%x", logical)
+	}
+	return node, nil
+}
+
+// buildTestTree builds a tree with perLeaf items per leaf and fanout
+// pointers per internal node. Item i has key (i, 1, 0).
+func buildTestTree(nItems, perLeaf, fanout int) (*memReader, uint64) {
+	r := &memReader{nodes: make(map[uint64]*Node)}
+	nextAddr := uint64(0x1000)
+
+	type ref struct {
+		key  *Key
+		addr uint64
+	}
+	var level []ref
+
+	for i := 0; i < nItems; i += perLeaf {
+		node := &Node{Header: &Header{Level: 0}}
+		for j := i; j < i+perLeaf && j < nItems; j++ {
+			node.Items = append(node.Items, &Item{
+				Key:  &Key{ObjectID: uint64(j), Type: 1},
+				Data: []byte{byte(j)},
+			})
+		}
+		node.Header.NrItems = uint32(len(node.Items))
+		r.nodes[nextAddr] = node
+		level = append(level, ref{node.Items[0].Key, nextAddr})
+		nextAddr += 0x1000
+	}
+
+	for lvl := uint8(1); len(level) > 1; lvl++ {
+		var next []ref
+		for i := 0; i < len(level); i += fanout {
+			node := &Node{Header: &Header{Level: lvl}}
+			for j := i; j < i+fanout && j < len(level); j++ {
+				node.Keys = append(node.Keys, level[j].key)
+				node.Ptrs = append(node.Ptrs, level[j].addr)
+			}
+			node.Header.NrItems = uint32(len(node.Keys))
+			r.nodes[nextAddr] = node
+			next = append(next, ref{node.Keys[0], nextAddr})
+			nextAddr += 0x1000
+		}
+		level = next
+	}
+
+	return r, level[0].addr
+}
+
+func TestSearchExactInternalKey(t *testing.T) {
+	r, root := buildTestTree(64, 4, 3)
+	s := NewSearcher(r, 4096)
+
+	// Every key is found, including keys that are also separator keys
+	// in internal nodes (the first key of each leaf).
+	for i := 0; i < 64; i++ {
+		path, err := s.Search(root, &Key{ObjectID: uint64(i), Type: 1})
+		if err != nil {
+			t.Fatalf("Search(%d) failed: %v", i, err)
+		}
+		item, err := path.GetItem()
+		if err != nil {
+			t.Fatalf("GetItem(%d) failed: %v", i, err)
+		}
+		if item.Key.ObjectID != uint64(i) {
+			t.Errorf("Search(%d) found key %d", i, item.Key.ObjectID)
+		}
+	}
+}
+
+func TestWalkCrossesLeaves(t *testing.T) {
+	r, root := buildTestTree(50, 3, 2)
+	s := NewSearcher(r, 4096)
+
+	var got []uint64
+	err := s.Walk(root, &Key{ObjectID: 7, Type: 1}, func(item *Item) (bool, error) {
+		got = append(got, item.Key.ObjectID)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	if len(got) != 43 {
+		t.Fatalf("Walk visited %d items, want 43", len(got))
+	}
+	for i, id := range got {
+		if id != uint64(7+i) {
+			t.Fatalf("item %d: got key %d, want %d", i, id, 7+i)
+		}
+	}
+}
+
+func TestWalkStartPastLeafEnd(t *testing.T) {
+	r, root := buildTestTree(12, 4, 4)
+	s := NewSearcher(r, 4096)
+
+	// (3, 2, 0) sorts after the last item of the first leaf, so the walk
+	// has to continue with the first item of the second leaf.
+	var first *Key
+	err := s.Walk(root, &Key{ObjectID: 3, Type: 2}, func(item *Item) (bool, error) {
+		first = item.Key
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if first == nil || first.ObjectID != 4 {
+		t.Fatalf("first item = %v, want key 4", first)
+	}
+}
+
+func TestWalkStopsEarly(t *testing.T) {
+	r, root := buildTestTree(100, 5, 3)
+	s := NewSearcher(r, 4096)
+
+	count := 0
+	err := s.Walk(root, &Key{}, func(item *Item) (bool, error) {
+		count++
+		return count < 10, nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if count != 10 {
+		t.Errorf("Walk visited %d items after stop, want 10", count)
+	}
+}
@@ -1,15 +1,35 @@
 package chunk
 
 import (
+	"encoding/binary"
 	"fmt"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+const (
+	// chunkItemSize is the size of struct btrfs_chunk without its stripes.
+	chunkItemSize = 48
+	// stripeSize is the size of one struct btrfs_stripe.
+	stripeSize = 32
 )
 
+// Stripe is one device extent of a chunk.
+type Stripe struct {
+	DeviceID   uint64
+	Offset     uint64 // Physical start on the device.
+	DeviceUUID [16]byte
+}
+
 // ChunkMapping represents a chunk mapping.
 type ChunkMapping struct {
 	LogicalStart  uint64
 	LogicalLength uint64
-	PhysicalStart uint64 // Simplified: supports a single physical location.
-	DeviceID      uint64
+	Type          uint64 // Block group type and RAID profile flags.
+	StripeLen     uint64 // Size of one stripe unit for striped profiles.
+	SubStripes    uint16 // Copies of each stripe unit in RAID10.
+	Stripes       []Stripe
 }
 
 // PhysicalAddr represents a physical address.
@@ -18,22 +38,299 @@ type PhysicalAddr struct {
 	Offset   uint64
 }
 
+// PhysicalRange is a run of bytes that is contiguous on one device.
+type PhysicalRange struct {
+	DeviceID uint64
+	Offset   uint64
+	Length   uint64
+}
+
+// parseChunkItem parses a CHUNK_ITEM (struct btrfs_chunk followed by
+// num_stripes struct btrfs_stripe) for the chunk starting at logical. It
+// returns the mapping and the number of bytes the item occupies.
+//
+//	struct btrfs_chunk {
+//	  __le64 length;
+//	  __le64 owner;
+//	  __le64 stripe_len;
+//	  __le64 type;
+//	  __le32 io_align, io_width, sector_size;
+//	  __le16 num_stripes;
+//	  __le16 sub_stripes;
+//	  struct btrfs_stripe stripe[];  // devid(8) + offset(8) + dev_uuid(16)
+//	}
+func parseChunkItem(logical uint64, data []byte) (*ChunkMapping, int, error) {
+	if len(data) < chunkItemSize {
+		return nil, 0, fmt.Errorf("chunk data too short: %d bytes", len(data))
+	}
+
+	numStripes := int(binary.LittleEndian.Uint16(data[44:46]))
+	if numStripes < 1 {
+		return nil, 0, fmt.Errorf("invalid num_stripes: %d", numStripes)
+	}
+
+	size := chunkItemSize + numStripes*stripeSize
+	if size > len(data) {
+		return nil, 0, fmt.Errorf("stripe data out of bounds: need %d bytes, have %d", size, len(data))
+	}
+
+	mapping := &ChunkMapping{
+		LogicalStart:  logical,
+		LogicalLength: binary.LittleEndian.Uint64(data[0:8]),
+		StripeLen:     binary.LittleEndian.Uint64(data[16:24]),
+		Type:          binary.LittleEndian.Uint64(data[24:32]),
+		SubStripes:    binary.LittleEndian.Uint16(data[46:48]),
+		Stripes:       make([]Stripe, numStripes),
+	}
+
+	for i := range mapping.Stripes {
+		s := data[chunkItemSize+i*stripeSize:]
+		mapping.Stripes[i].DeviceID = binary.LittleEndian.Uint64(s[0:8])
+		mapping.Stripes[i].Offset = binary.LittleEndian.Uint64(s[8:16])
+		copy(mapping.Stripes[i].DeviceUUID[:], s[16:32])
+	}
+
+	if err := mapping.validate(); err != nil {
+		return nil, 0, err
+	}
+
+	return mapping, size, nil
+}
+
+// validate checks that the stripe geometry is usable by MapAddress.
+func (c *ChunkMapping) validate() error {
+	switch c.Type & ondisk.BlockGroupProfileMask {
+	case ondisk.BlockGroupRaid0:
+		if c.StripeLen == 0 {
+			return fmt.Errorf("%w: RAID0 chunk 0x%x has stripe_len 0", errors.ErrInvalidChunkMapping, c.LogicalStart)
+		}
+	case ondisk.BlockGroupRaid10:
+		if c.StripeLen == 0 || c.SubStripes == 0 || len(c.Stripes)%int(c.SubStripes) != 0 {
+			return fmt.Errorf("%w: RAID10 chunk 0x%x has %d stripes, sub_stripes %d, stripe_len %d",
+				errors.ErrInvalidChunkMapping, c.LogicalStart, len(c.Stripes), c.SubStripes, c.StripeLen)
+		}
+	case ondisk.BlockGroupRaid5, ondisk.BlockGroupRaid6:
+		if c.StripeLen == 0 || len(c.Stripes) <= c.nrParity() {
+			return fmt.Errorf("%w: RAID5/6 chunk 0x%x has %d stripes, stripe_len %d",
+				errors.ErrInvalidChunkMapping, c.LogicalStart, len(c.Stripes), c.StripeLen)
+		}
+	}
+	return nil
+}
+
 // Contains reports whether a logical address is in this chunk range.
 func (c *ChunkMapping) Contains(logical uint64) bool {
 	return logical >= c.LogicalStart && logical < c.LogicalStart+c.LogicalLength
 }
 
-// MapAddress maps a logical address to a physical address (simplified: SINGLE type).
+// NumCopies returns how many copies of each byte the chunk stores: the
+// number of stripes for DUP and the RAID1 profiles, sub_stripes for RAID10
+// and 1 otherwise. Like the kernel, RAID5 counts as 2 copies and RAID6 as 3:
+// the data itself and its reconstructions from parity.
+func (c *ChunkMapping) NumCopies() int {
+	switch c.Type & ondisk.BlockGroupProfileMask {
+	case ondisk.BlockGroupDup, ondisk.BlockGroupRaid1, ondisk.BlockGroupRaid1C3, ondisk.BlockGroupRaid1C4:
+		return len(c.Stripes)
+	case ondisk.BlockGroupRaid10:
+		return int(c.SubStripes)
+	case ondisk.BlockGroupRaid5, ondisk.BlockGroupRaid6:
+		return 1 + c.nrParity()
+	}
+	return 1
+}
+
+// MapAddress maps a logical address to a physical address on the first
+// copy of the data.
 func (c *ChunkMapping) MapAddress(logical uint64) (*PhysicalAddr, error) {
+	r, err := c.mapRange(logical, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &PhysicalAddr{DeviceID: r.DeviceID, Offset: r.Offset}, nil
+}
+
+// MapMirrors maps a logical address to its physical address on every copy,
+// in mirror order. RAID5/6 data has a single location.
+func (c *ChunkMapping) MapMirrors(logical uint64) ([]*PhysicalAddr, error) {
+	copies := c.NumCopies()
+	if c.isParity() {
+		copies = 1
+	}
+
+	addrs := make([]*PhysicalAddr, 0, copies)
+	for mirror := 0; mirror < copies; mirror++ {
+		r, err := c.mapRange(logical, 1, mirror)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, &PhysicalAddr{DeviceID: r.DeviceID, Offset: r.Offset})
+	}
+	return addrs, nil
+}
+
+// mapRange maps the start of [logical, logical+length) to the device
+// range holding it on copy mirror (0-based). The range is cut at the end
+// of the stripe unit (or of the chunk for unstriped profiles), so the
+// returned Length may be shorter than length.
+func (c *ChunkMapping) mapRange(logical uint64, length uint64, mirror int) (*PhysicalRange, error) {
 	if !c.Contains(logical) {
 		return nil, fmt.Errorf("logical address 0x%x not in chunk range [0x%x, 0x%x)",
 			logical, c.LogicalStart, c.LogicalStart+c.LogicalLength)
 	}
+	if mirror < 0 || mirror >= c.NumCopies() {
+		return nil, fmt.Errorf("chunk 0x%x has no copy %d (%d copies)", c.LogicalStart, mirror+1, c.NumCopies())
+	}
+	if mirror > 0 && c.isParity() {
+		return nil, fmt.Errorf("copy %d of RAID5/6 chunk 0x%x is rebuilt from parity, not mapped", mirror+1, c.LogicalStart)
+	}
 
 	offsetInChunk := logical - c.LogicalStart
+	remaining := c.LogicalLength - offsetInChunk
+
+	// Index of the stripe holding the address and the offset into it.
+	var stripeIndex uint64
+	var physOffset uint64
+
+	switch profile := c.Type & ondisk.BlockGroupProfileMask; profile {
+	case 0, ondisk.BlockGroupDup, ondisk.BlockGroupRaid1, ondisk.BlockGroupRaid1C3, ondisk.BlockGroupRaid1C4:
+		// Every stripe holds a full copy of the chunk.
+		stripeIndex = uint64(mirror)
+		physOffset = offsetInChunk
+
+	case ondisk.BlockGroupRaid0, ondisk.BlockGroupRaid10:
+		// Stripe units are laid out round-robin over the stripes, or over
+		// groups of sub_stripes mirrored stripes for RAID10, where mirror
+		// selects the stripe within the group:
+		//   stripe_nr = offset / stripe_len
+		//   index     = stripe_nr % groups
+		//   row       = stripe_nr / groups
+		groups := uint64(len(c.Stripes))
+		subStripes := uint64(1)
+		if profile == ondisk.BlockGroupRaid10 {
+			subStripes = uint64(c.SubStripes)
+			groups /= subStripes
+		}
+
+		stripeNr := offsetInChunk / c.StripeLen
+		stripeOffset := offsetInChunk % c.StripeLen
 
-	return &PhysicalAddr{
-		DeviceID: c.DeviceID,
-		Offset:   c.PhysicalStart + offsetInChunk,
+		stripeIndex = (stripeNr%groups)*subStripes + uint64(mirror)
+		physOffset = (stripeNr/groups)*c.StripeLen + stripeOffset
+		remaining = min64(remaining, c.StripeLen-stripeOffset)
+
+	case ondisk.BlockGroupRaid5, ondisk.BlockGroupRaid6:
+		// The parity stripes rotate; see raid56.go.
+		row, dataIndex, stripeOffset := c.parityRow(logical)
+
+		stripeIndex = (uint64(dataIndex) + row) % uint64(len(c.Stripes))
+		physOffset = row*c.StripeLen + stripeOffset
+		remaining = min64(remaining, c.StripeLen-stripeOffset)
+
+	default:
+		return nil, fmt.Errorf("%w: chunk 0x%x has profile 0x%x",
+			errors.ErrUnsupportedRaidType, c.LogicalStart, profile)
+	}
+
+	stripe := c.Stripes[stripeIndex]
+	return &PhysicalRange{
+		DeviceID: stripe.DeviceID,
+		Offset:   stripe.Offset + physOffset,
+		Length:   min64(length, remaining),
 	}, nil
 }
+
+// LogicalAddr is the logical address stored at a physical offset of a
+// device, as found by PhysicalToLogical.
+type LogicalAddr struct {
+	Logical    uint64 // Logical address of the byte; for parity, Protects[0]
+	ChunkStart uint64 // Logical start of the chunk
+	Type       uint64 // Block group type and RAID profile flags of the chunk
+	Stripe     int    // Index of the stripe of the chunk holding the byte
+	Mirror     int    // Copy (0-based) of the byte held by the stripe
+	Parity     int    // 1 for P and 2 for Q parity of RAID5/6, 0 for data
+
+	// Protects lists, for a parity byte, the logical address of the byte
+	// at the same offset in each data stripe unit of its row.
+	Protects []uint64
+}
+
+// stripeLength returns how many bytes of its device each stripe of the
+// chunk occupies.
+func (c *ChunkMapping) stripeLength() uint64 {
+	dataStripes := uint64(1)
+	switch c.Type & ondisk.BlockGroupProfileMask {
+	case ondisk.BlockGroupRaid0:
+		dataStripes = uint64(len(c.Stripes))
+	case ondisk.BlockGroupRaid10:
+		dataStripes = uint64(len(c.Stripes)) / uint64(c.SubStripes)
+	case ondisk.BlockGroupRaid5, ondisk.BlockGroupRaid6:
+		dataStripes = uint64(len(c.Stripes) - c.nrParity())
+	}
+	return (c.LogicalLength + dataStripes - 1) / dataStripes
+}
+
+// physicalToLogical maps an offset into stripe index of the chunk back to
+// the logical address it holds. It is the inverse of mapRange. It returns
+// nil for the unused tail of a stripe.
+func (c *ChunkMapping) physicalToLogical(index int, offset uint64) *LogicalAddr {
+	addr := &LogicalAddr{ChunkStart: c.LogicalStart, Type: c.Type, Stripe: index}
+	n := uint64(len(c.Stripes))
+
+	var offsetInChunk uint64
+	switch profile := c.Type & ondisk.BlockGroupProfileMask; profile {
+	case ondisk.BlockGroupRaid0, ondisk.BlockGroupRaid10:
+		// stripe_nr = row * groups + group, with the stripe the mirror
+		// within its group of sub_stripes.
+		subStripes := uint64(1)
+		if profile == ondisk.BlockGroupRaid10 {
+			subStripes = uint64(c.SubStripes)
+		}
+		groups := n / subStripes
+		group := uint64(index) / subStripes
+		addr.Mirror = int(uint64(index) % subStripes)
+
+		stripeNr := (offset/c.StripeLen)*groups + group
+		offsetInChunk = stripeNr*c.StripeLen + offset%c.StripeLen
+
+	case ondisk.BlockGroupRaid5, ondisk.BlockGroupRaid6:
+		// The stripe holds unit (index - row) mod n of its row; the units
+		// after the data units are P and Q.
+		row := offset / c.StripeLen
+		nrData := n - uint64(c.nrParity())
+		unit := (uint64(index) + n - row%n) % n
+
+		rowStart := row*nrData*c.StripeLen + offset%c.StripeLen
+		if unit >= nrData {
+			addr.Parity = int(unit-nrData) + 1
+			for i := uint64(0); i < nrData; i++ {
+				if logical := rowStart + i*c.StripeLen; logical < c.LogicalLength {
+					addr.Protects = append(addr.Protects, c.LogicalStart+logical)
+				}
+			}
+			if len(addr.Protects) == 0 {
+				return nil
+			}
+			addr.Logical = addr.Protects[0]
+			return addr
+		}
+		offsetInChunk = rowStart + unit*c.StripeLen
+
+	default:
+		// SINGLE, DUP and RAID1*: every stripe is a full copy.
+		addr.Mirror = index
+		offsetInChunk = offset
+	}
+
+	if offsetInChunk >= c.LogicalLength {
+		return nil
+	}
+	addr.Logical = c.LogicalStart + offsetInChunk
+	return addr
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,282 @@
+package chunk
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+const testStripeLen = 64 * 1024
+
+// chunkItem encodes a CHUNK_ITEM with one stripe per (devid, offset) pair.
+func chunkItem(length, typ uint64, subStripes uint16, stripes ...[2]uint64) []byte {
+	b := make([]byte, chunkItemSize+len(stripes)*stripeSize)
+	le := binary.LittleEndian
+	le.PutUint64(b[0:], length)
+	le.PutUint64(b[8:], 2)
+	le.PutUint64(b[16:], testStripeLen)
+	le.PutUint64(b[24:], typ)
+	le.PutUint16(b[44:], uint16(len(stripes)))
+	le.PutUint16(b[46:], subStripes)
+	for i, s := range stripes {
+		le.PutUint64(b[chunkItemSize+i*stripeSize:], s[0])
+		le.PutUint64(b[chunkItemSize+i*stripeSize+8:], s[1])
+	}
+	return b
+}
+
+func TestParseChunkItem(t *testing.T) {
+	data := chunkItem(1<<30, ondisk.BlockGroupData|ondisk.BlockGroupRaid10, 2,
+		[2]uint64{1, 0x100000}, [2]uint64{2, 0x200000}, [2]uint64{3, 0x300000}, [2]uint64{4, 0x400000})
+
+	m, size, err := parseChunkItem(0x10000000, data)
+	if err != nil {
+		t.Fatalf("parseChunkItem failed: %v", err)
+	}
+	if size != len(data) || len(m.Stripes) != 4 || m.SubStripes != 2 || m.StripeLen != testStripeLen {
+		t.Fatalf("parsed %+v (size %d)", m, size)
+	}
+	if m.Stripes[3].DeviceID != 4 || m.Stripes[3].Offset != 0x400000 {
+		t.Errorf("stripe 3 = %+v", m.Stripes[3])
+	}
+
+	// Three stripes cannot form mirrored pairs.
+	bad := chunkItem(1<<30, ondisk.BlockGroupRaid10, 2, [2]uint64{1, 0}, [2]uint64{2, 0}, [2]uint64{3, 0})
+	if _, _, err := parseChunkItem(0, bad); !errors.Is(err, errors.ErrInvalidChunkMapping) {
+		t.Errorf("odd RAID10 stripe count: err = %v", err)
+	}
+	if _, _, err := parseChunkItem(0, data[:chunkItemSize+stripeSize]); err == nil {
+		t.Error("truncated stripes should fail")
+	}
+}
+
+func TestMapAddressStriped(t *testing.T) {
+	const start = 0x10000000
+	raid0, _, _ := parseChunkItem(start, chunkItem(6*testStripeLen, ondisk.BlockGroupRaid0, 1,
+		[2]uint64{1, 0x100000}, [2]uint64{2, 0x200000}, [2]uint64{3, 0x300000}))
+	raid10, _, _ := parseChunkItem(start, chunkItem(4*testStripeLen, ondisk.BlockGroupRaid10, 2,
+		[2]uint64{1, 0x100000}, [2]uint64{2, 0x200000}, [2]uint64{3, 0x300000}, [2]uint64{4, 0x400000}))
+
+	tests := []struct {
+		name    string
+		mapping *ChunkMapping
+		offset  uint64
+		want    PhysicalAddr
+	}{
+		{"raid0 first unit", raid0, 0x123, PhysicalAddr{1, 0x100123}},
+		{"raid0 second unit", raid0, testStripeLen + 5, PhysicalAddr{2, 0x200005}},
+		{"raid0 second row", raid0, 4*testStripeLen + 7, PhysicalAddr{2, 0x200000 + testStripeLen + 7}},
+		{"raid10 first pair", raid10, 9, PhysicalAddr{1, 0x100009}},
+		{"raid10 second pair", raid10, testStripeLen, PhysicalAddr{3, 0x300000}},
+		{"raid10 second row", raid10, 3*testStripeLen + 1, PhysicalAddr{3, 0x300000 + testStripeLen + 1}},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.mapping.MapAddress(start + tt.offset)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestMapRangeSplitsStripes(t *testing.T) {
+	const start = 0x10000000
+	m := NewManager()
+	m.AddMapping(&ChunkMapping{
+		LogicalStart:  start,
+		LogicalLength: 4 * testStripeLen,
+		Type:          ondisk.BlockGroupRaid0,
+		StripeLen:     testStripeLen,
+		SubStripes:    1,
+		Stripes:       []Stripe{{DeviceID: 1, Offset: 0x100000}, {DeviceID: 1, Offset: 0x800000}},
+	})
+
+	// 100 bytes before the end of the first unit, through the whole second
+	// unit and 10 bytes into the third.
+	ranges, err := m.MapRange(start+testStripeLen-100, 100+testStripeLen+10, 0)
+	if err != nil {
+		t.Fatalf("MapRange failed: %v", err)
+	}
+
+	want := []PhysicalRange{
+		{1, 0x100000 + testStripeLen - 100, 100},
+		{1, 0x800000, testStripeLen},
+		{1, 0x100000 + testStripeLen, 10},
+	}
+	if len(ranges) != len(want) {
+		t.Fatalf("got %d ranges %+v, want %+v", len(ranges), ranges, want)
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Errorf("range %d = %+v, want %+v", i, ranges[i], want[i])
+		}
+	}
+
+	if _, err := m.MapRange(start+4*testStripeLen-1, 2, 0); err == nil {
+		t.Error("MapRange past the end of the chunk should fail")
+	}
+}
+
+func TestParseSystemChunkArray(t *testing.T) {
+	var array []byte
+	add := func(logical uint64, item []byte) {
+		key := make([]byte, 17)
+		binary.LittleEndian.PutUint64(key[0:], 256)
+		key[8] = 228
+		binary.LittleEndian.PutUint64(key[9:], logical)
+		array = append(append(array, key...), item...)
+	}
+	add(0x100000, chunkItem(4<<20, ondisk.BlockGroupSystem|ondisk.BlockGroupRaid0, 1,
+		[2]uint64{1, 0x100000}, [2]uint64{2, 0x100000}))
+	// A single-stripe entry exactly fills the rest of the array.
+	add(0x500000, chunkItem(4<<20, ondisk.BlockGroupSystem, 1, [2]uint64{1, 0x500000}))
+
+	buf := make([]byte, 2048)
+	copy(buf, array)
+
+	m := NewManager()
+	if err := m.ParseSystemChunkArray(buf, uint32(len(array))); err != nil {
+		t.Fatalf("ParseSystemChunkArray failed: %v", err)
+	}
+	if m.Len() != 2 {
+		t.Fatalf("parsed %d chunks, want 2", m.Len())
+	}
+
+	addrs, err := m.LogicalToPhysical(0x100000 + testStripeLen)
+	if err != nil || len(addrs) != 1 || *addrs[0] != (PhysicalAddr{2, 0x100000}) {
+		t.Errorf("LogicalToPhysical = %+v, %v", addrs, err)
+	}
+}
+
+func TestMapMirrors(t *testing.T) {
+	const start = 0x10000000
+	m := NewManager()
+	dup, _, _ := parseChunkItem(start, chunkItem(1<<20, ondisk.BlockGroupMetadata|ondisk.BlockGroupDup, 1,
+		[2]uint64{1, 0x100000}, [2]uint64{1, 0x300000}))
+	raid10, _, _ := parseChunkItem(2*start, chunkItem(4*testStripeLen, ondisk.BlockGroupRaid10, 2,
+		[2]uint64{1, 0x100000}, [2]uint64{2, 0x200000}, [2]uint64{3, 0x300000}, [2]uint64{4, 0x400000}))
+	single, _, _ := parseChunkItem(start+1<<20, chunkItem(1<<20, ondisk.BlockGroupData, 1, [2]uint64{2, 0x100000}))
+	m.AddMapping(dup)
+	m.AddMapping(raid10)
+	m.AddMapping(single)
+
+	tests := []struct {
+		logical uint64
+		want    []PhysicalAddr
+	}{
+		{start + 0x1234, []PhysicalAddr{{1, 0x101234}, {1, 0x301234}}},
+		{2*start + testStripeLen + 8, []PhysicalAddr{{3, 0x300008}, {4, 0x400008}}},
+	}
+	for _, tt := range tests {
+		addrs, err := m.LogicalToPhysical(tt.logical)
+		if err != nil {
+			t.Fatalf("LogicalToPhysical(0x%x) failed: %v", tt.logical, err)
+		}
+		if n := m.NumCopies(tt.logical, 1); n != len(tt.want) || len(addrs) != len(tt.want) {
+			t.Fatalf("0x%x: NumCopies = %d, %d addresses, want %d", tt.logical, n, len(addrs), len(tt.want))
+		}
+		for i := range tt.want {
+			if *addrs[i] != tt.want[i] {
+				t.Errorf("0x%x copy %d = %+v, want %+v", tt.logical, i+1, *addrs[i], tt.want[i])
+			}
+		}
+	}
+
+	// A range into the next chunk has only the copies both chunks have.
+	if n := m.NumCopies(start+1<<20-0x1000, 0x2000); n != 1 {
+		t.Errorf("NumCopies across DUP and SINGLE = %d, want 1", n)
+	}
+	if n := m.NumCopies(start+1<<20-0x1000, 0x1000); n != 2 {
+		t.Errorf("NumCopies up to the end of DUP = %d, want 2", n)
+	}
+
+	ranges, err := m.MapRange(start+0x1000, 0x2000, 1)
+	if err != nil || len(ranges) != 1 || ranges[0] != (PhysicalRange{1, 0x301000, 0x2000}) {
+		t.Errorf("MapRange of copy 2 = %+v, %v", ranges, err)
+	}
+	if _, err := m.MapRange(start, 1, 2); err == nil {
+		t.Error("MapRange of a third DUP copy should fail")
+	}
+}
+
+func TestPhysicalToLogical(t *testing.T) {
+	const start = 0x10000000
+	stripes := func(n int) [][2]uint64 {
+		var s [][2]uint64
+		for i := 0; i < n; i++ {
+			s = append(s, [2]uint64{uint64(i + 1), uint64(i+1) * 0x1000000})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		typ     uint64
+		sub     uint16
+		stripes [][2]uint64
+	}{
+		{"single", 0, 1, stripes(1)},
+		{"dup", ondisk.BlockGroupDup, 1, [][2]uint64{{1, 0x1000000}, {1, 0x2000000}}},
+		{"raid1", ondisk.BlockGroupRaid1, 1, stripes(2)},
+		{"raid0", ondisk.BlockGroupRaid0, 1, stripes(3)},
+		{"raid10", ondisk.BlockGroupRaid10, 2, stripes(4)},
+		{"raid5", ondisk.BlockGroupRaid5, 1, stripes(4)},
+		{"raid6", ondisk.BlockGroupRaid6, 1, stripes(5)},
+	}
+
+	for _, tt := range tests {
+		c, _, err := parseChunkItem(start, chunkItem(12*testStripeLen, ondisk.BlockGroupData|tt.typ, tt.sub, tt.stripes...))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		m := NewManager()
+		m.AddMapping(c)
+
+		// Every copy of every address maps back to the address.
+		for off := uint64(0); off < c.LogicalLength; off += 0x3001 {
+			addrs, err := m.LogicalToPhysical(start + off)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			for mirror, pa := range addrs {
+				got, err := m.PhysicalToLogical(pa.DeviceID, pa.Offset)
+				if err != nil || got.Logical != start+off || got.Mirror != mirror || got.Parity != 0 {
+					t.Fatalf("%s: PhysicalToLogical(%d, 0x%x) = %+v, %v, want logical 0x%x copy %d",
+						tt.name, pa.DeviceID, pa.Offset, got, err, start+off, mirror)
+				}
+			}
+		}
+
+		// Parity bytes report the data they protect.
+		if c.isParity() {
+			nrData := len(c.Stripes) - c.nrParity()
+			for row := uint64(0); row*uint64(nrData)*testStripeLen < c.LogicalLength; row++ {
+				for p := 1; p <= c.nrParity(); p++ {
+					s := c.rowStripe(row, nrData+p-1)
+					got, err := m.PhysicalToLogical(s.DeviceID, s.Offset+row*testStripeLen+5)
+					if err != nil || got.Parity != p || len(got.Protects) != nrData {
+						t.Fatalf("%s: parity %d of row %d = %+v, %v", tt.name, p, row, got, err)
+					}
+					for i, logical := range got.Protects {
+						want := start + (row*uint64(nrData)+uint64(i))*testStripeLen + 5
+						if logical != want {
+							t.Errorf("%s: parity %d of row %d protects 0x%x, want 0x%x", tt.name, p, row, logical, want)
+						}
+					}
+				}
+			}
+		}
+
+		// Past the end of the stripe is not part of the chunk.
+		last := c.Stripes[len(c.Stripes)-1]
+		if _, err := m.PhysicalToLogical(last.DeviceID, last.Offset+c.stripeLength()); !errors.Is(err, errors.ErrChunkNotFound) {
+			t.Errorf("%s: offset past the stripe: err = %v", tt.name, err)
+		}
+	}
+}
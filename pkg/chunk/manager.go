@@ -8,6 +8,7 @@ import (
 
 	"github.com/WinBeyond/btrfs-read/pkg/errors"
 	"github.com/WinBeyond/btrfs-read/pkg/logger"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
 )
 
 func min(a, b int) int {
@@ -21,15 +22,42 @@ func min(a, b int) int {
 type Manager struct {
 	mu       sync.RWMutex
 	mappings []*ChunkMapping // Sorted by LogicalStart.
+	devices  map[uint64]*ondisk.DevItem
 }
 
 // NewManager creates a manager.
 func NewManager() *Manager {
 	return &Manager{
 		mappings: make([]*ChunkMapping, 0),
+		devices:  make(map[uint64]*ondisk.DevItem),
 	}
 }
 
+// AddDevice records a DEV_ITEM of the chunk tree, which describes one
+// member device of the filesystem.
+func (m *Manager) AddDevice(item *ondisk.DevItem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.devices[item.DevID] = item
+}
+
+// Devices returns the member devices recorded in the chunk tree, sorted by
+// device ID.
+func (m *Manager) Devices() []*ondisk.DevItem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := make([]*ondisk.DevItem, 0, len(m.devices))
+	for _, item := range m.devices {
+		devices = append(devices, item)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].DevID < devices[j].DevID
+	})
+	return devices
+}
+
 // AddMapping adds a chunk mapping.
 func (m *Manager) AddMapping(mapping *ChunkMapping) {
 	m.mu.Lock()
@@ -43,8 +71,10 @@ func (m *Manager) AddMapping(mapping *ChunkMapping) {
 	})
 }
 
-// LogicalToPhysical maps a logical address to a physical address.
-func (m *Manager) LogicalToPhysical(logical uint64) (*PhysicalAddr, error) {
+// LogicalToPhysical maps a logical address to its physical address on every
+// copy: one address for SINGLE, RAID0, RAID5 and RAID6, and one per mirror
+// for DUP, RAID1, RAID1C3, RAID1C4 and RAID10.
+func (m *Manager) LogicalToPhysical(logical uint64) ([]*PhysicalAddr, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -56,7 +86,145 @@ func (m *Manager) LogicalToPhysical(logical uint64) (*PhysicalAddr, error) {
 	}
 
 	// Map address.
-	return mapping.MapAddress(logical)
+	return mapping.MapMirrors(logical)
+}
+
+// PhysicalToLogical maps an offset of a device back to the logical address
+// stored there, using the stripes of the chunk items: the reverse of
+// LogicalToPhysical. For a mirrored profile the copy is reported in Mirror,
+// and for RAID5/6 parity the data it protects in Protects. It fails with
+// ErrChunkNotFound for an offset that no chunk uses.
+func (m *Manager) PhysicalToLogical(devID uint64, physical uint64) (*LogicalAddr, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, mapping := range m.mappings {
+		length := mapping.stripeLength()
+		for i, s := range mapping.Stripes {
+			if s.DeviceID != devID || physical < s.Offset || physical >= s.Offset+length {
+				continue
+			}
+			if addr := mapping.physicalToLogical(i, physical-s.Offset); addr != nil {
+				return addr, nil
+			}
+		}
+	}
+
+	return nil, errors.Wrap("PhysicalToLogical",
+		fmt.Errorf("%w: device %d offset 0x%x is not in any chunk", errors.ErrChunkNotFound, devID, physical))
+}
+
+// NumCopies returns the number of copies stored for all of [logical,
+// logical+length): the smallest count of the chunks the range crosses. It
+// returns 1 if part of the range is unmapped, so that a read of copy 0
+// reports the mapping error.
+func (m *Manager) NumCopies(logical uint64, length uint64) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	copies := 0
+	end := logical + length
+	for {
+		mapping := m.findMapping(logical)
+		if mapping == nil {
+			return 1
+		}
+		if n := mapping.NumCopies(); copies == 0 || n < copies {
+			copies = n
+		}
+
+		logical = mapping.LogicalStart + mapping.LogicalLength
+		if logical >= end {
+			return copies
+		}
+	}
+}
+
+// MapRange maps [logical, logical+length) to the device ranges holding copy
+// mirror (0-based) of it, in logical order. A range is split wherever it
+// crosses a stripe unit or chunk boundary.
+func (m *Manager) MapRange(logical uint64, length uint64, mirror int) ([]PhysicalRange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ranges []PhysicalRange
+	for length > 0 {
+		mapping := m.findMapping(logical)
+		if mapping == nil {
+			return nil, errors.Wrap("MapRange",
+				fmt.Errorf("no chunk mapping found for logical 0x%x", logical))
+		}
+
+		r, err := mapping.mapRange(logical, length, mirror)
+		if err != nil {
+			return nil, err
+		}
+
+		// Merge with the previous range when the stripes happen to be
+		// adjacent on disk (always the case for SINGLE and DUP).
+		if n := len(ranges); n > 0 && ranges[n-1].DeviceID == r.DeviceID &&
+			ranges[n-1].Offset+ranges[n-1].Length == r.Offset {
+			ranges[n-1].Length += r.Length
+		} else {
+			ranges = append(ranges, *r)
+		}
+
+		logical += r.Length
+		length -= r.Length
+	}
+
+	return ranges, nil
+}
+
+// ReadLogical fills buf with copy mirror (0-based) of the data at a logical
+// address, reading through dev. Copies beyond the first of a RAID5/6 chunk
+// are rebuilt from the other stripe units of each row and the parity, with
+// the method selected by mirror (see ChunkMapping.rebuild).
+func (m *Manager) ReadLogical(dev DeviceReader, logical uint64, buf []byte, mirror int) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for len(buf) > 0 {
+		mapping := m.findMapping(logical)
+		if mapping == nil {
+			return errors.Wrap("ReadLogical",
+				fmt.Errorf("no chunk mapping found for logical 0x%x", logical))
+		}
+
+		rebuild := mapping.isParity() && mirror > 0
+		mapMirror := mirror
+		if rebuild {
+			if mirror >= mapping.NumCopies() {
+				return fmt.Errorf("RAID5/6 chunk 0x%x has no copy %d (%d copies)",
+					mapping.LogicalStart, mirror+1, mapping.NumCopies())
+			}
+			mapMirror = 0
+		}
+
+		r, err := mapping.mapRange(logical, uint64(len(buf)), mapMirror)
+		if err != nil {
+			return err
+		}
+
+		if rebuild {
+			// A unit that cannot be rebuilt, e.g. because the device of
+			// another unit in its row is missing too, is read directly.
+			err = mapping.rebuild(dev, logical, buf[:r.Length], mirror)
+			if err != nil && dev.ReadDevice(r.DeviceID, buf[:r.Length], r.Offset) == nil {
+				err = nil
+			}
+		} else {
+			err = dev.ReadDevice(r.DeviceID, buf[:r.Length], r.Offset)
+		}
+		if err != nil {
+			return err
+		}
+
+		buf = buf[r.Length:]
+		logical += r.Length
+	}
+
+	return nil
 }
 
 func (m *Manager) findMapping(logical uint64) *ChunkMapping {
@@ -84,11 +252,14 @@ func (m *Manager) ParseSystemChunkArray(data []byte, arraySize uint32) error {
 		logger.Warn("System chunk array size is 0")
 		return nil
 	}
+	if int(arraySize) > len(data) {
+		return fmt.Errorf("system chunk array size %d exceeds %d bytes", arraySize, len(data))
+	}
 
 	offset := 0
 	for offset < int(arraySize) {
 		// Ensure enough space to read a minimal chunk (key + header + 1 stripe).
-		minChunkSize := 17 + 50 + 32 // 99 bytes
+		minChunkSize := 17 + chunkItemSize + stripeSize // 97 bytes
 		if offset+minChunkSize > int(arraySize) {
 			// Not enough remaining space; stop parsing.
 			break
@@ -108,58 +279,15 @@ func (m *Manager) ParseSystemChunkArray(data []byte, arraySize uint32) error {
 			return fmt.Errorf("invalid system chunk array entry: objectid=%d, type=%d", objectID, keyType)
 		}
 
-		// Ensure enough space to read the chunk header.
-		if offset+50 > int(arraySize) {
-			return fmt.Errorf("chunk header exceeds array size")
-		}
-
-		// Parse chunk item header (48 bytes).
-		// struct btrfs_chunk {
-		//   __le64 length;
-		//   __le64 __unused1;
-		//   __le64 stripe_len;
-		//   __le64 type;
-		//   __le32 __unused2[3];  // 12 bytes
-		//   __le16 num_stripes;
-		//   __le16 sub_stripes;
-		// }
-		length := binary.LittleEndian.Uint64(data[offset:])
-		chunkType := binary.LittleEndian.Uint64(data[offset+24:])
-		numStripes := binary.LittleEndian.Uint16(data[offset+44:])
-		offset += 48
-
-		// Ensure enough space to read stripes.
-		if offset+int(numStripes)*32 > int(arraySize) {
-			logger.Error("Stripe data exceeds array size: need %d bytes, only %d remaining (arraySize=%d, offset=%d)",
-				int(numStripes)*32, int(arraySize)-offset, arraySize, offset)
-			return fmt.Errorf("stripe data exceeds array size")
-		}
-
-		// Only SINGLE/DUP types are supported (simplified).
-		raidBits := chunkType & 0x1F8
-		if raidBits != 0 && raidBits != (1<<5) {
-			offset += int(numStripes) * 32
-			continue
-		}
-
-		if numStripes < 1 {
-			return fmt.Errorf("invalid num_stripes: %d", numStripes)
-		}
-
-		// Read the first stripe.
-		devID := binary.LittleEndian.Uint64(data[offset:])
-		stripeOffset := binary.LittleEndian.Uint64(data[offset+8:])
-
-		mapping := &ChunkMapping{
-			LogicalStart:  keyOffset,
-			LogicalLength: length,
-			PhysicalStart: stripeOffset,
-			DeviceID:      devID,
+		mapping, size, err := parseChunkItem(keyOffset, data[offset:arraySize])
+		if err != nil {
+			logger.Error("Bad system chunk at 0x%x (arraySize=%d, offset=%d): %v", keyOffset, arraySize, offset, err)
+			return fmt.Errorf("system chunk array entry at offset %d: %w", offset, err)
 		}
 
 		m.AddMapping(mapping)
 
-		offset += int(numStripes) * 32
+		offset += size
 	}
 
 	return nil
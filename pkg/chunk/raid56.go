@@ -0,0 +1,200 @@
+package chunk
+
+import (
+	"fmt"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// RAID5/6 chunks store rows of nr_data data stripe units followed by P
+// (XOR) and, for RAID6, Q (Reed-Solomon) parity. The layout rotates by one
+// stripe per row: data unit i of row r lives on stripe (i+r) % num_stripes,
+// P on stripe (nr_data+r) % num_stripes and Q on the stripe after P.
+//
+// Q is the syndrome sum(g^i * D_i) over GF(2^8) with generator g = 2 and
+// the polynomial x^8+x^4+x^3+x^2+1 (0x11d), as in the kernel's lib/raid6.
+
+// gfExp and gfLog are the power and logarithm tables of GF(2^8). gfExp is
+// doubled so that products can be looked up without a modulo.
+var gfExp, gfLog = func() ([510]byte, [256]byte) {
+	var exp [510]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		exp[i+255] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	return exp, log
+}()
+
+// gfMul multiplies two elements of GF(2^8).
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// gfInv returns the multiplicative inverse of a non-zero element.
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfPow2 returns g^n for the generator g = 2.
+func gfPow2(n int) byte {
+	return gfExp[n%255]
+}
+
+// DeviceReader reads from the devices of a filesystem by device ID. It
+// returns errors.ErrDeviceNotFound for a device that is not available.
+type DeviceReader interface {
+	ReadDevice(devID uint64, p []byte, offset uint64) error
+}
+
+// isParity reports whether the chunk uses a RAID5 or RAID6 profile.
+func (c *ChunkMapping) isParity() bool {
+	return c.Type&(ondisk.BlockGroupRaid5|ondisk.BlockGroupRaid6) != 0
+}
+
+// nrParity returns the number of parity stripes per row: 1 for RAID5 and
+// 2 for RAID6.
+func (c *ChunkMapping) nrParity() int {
+	if c.Type&ondisk.BlockGroupRaid6 != 0 {
+		return 2
+	}
+	return 1
+}
+
+// parityRow locates a logical address in a RAID5/6 chunk: its row, the
+// data index of its stripe unit in the row and the offset into the unit.
+func (c *ChunkMapping) parityRow(logical uint64) (row uint64, dataIndex int, stripeOffset uint64) {
+	nrData := uint64(len(c.Stripes) - c.nrParity())
+	offsetInChunk := logical - c.LogicalStart
+	stripeNr := offsetInChunk / c.StripeLen
+
+	return stripeNr / nrData, int(stripeNr % nrData), offsetInChunk % c.StripeLen
+}
+
+// rowStripe returns the stripe holding unit index of a row, where indexes
+// 0..nr_data-1 are data units, nr_data is P and nr_data+1 is Q.
+func (c *ChunkMapping) rowStripe(row uint64, index int) Stripe {
+	return c.Stripes[(uint64(index)+row)%uint64(len(c.Stripes))]
+}
+
+// rebuild reconstructs dst, which lies within one data stripe unit starting
+// at logical, from the other units of its row. mirror selects the method:
+//
+//   - 1: XOR of P and the other data units. On RAID6, if one other data
+//     unit cannot be read either, both are solved for using P and Q.
+//   - 2 (RAID6): the other data units and Q, for when P is also bad.
+func (c *ChunkMapping) rebuild(dev DeviceReader, logical uint64, dst []byte, mirror int) error {
+	row, target, stripeOffset := c.parityRow(logical)
+	nrData := len(c.Stripes) - c.nrParity()
+	offset := row*c.StripeLen + stripeOffset
+
+	read := func(index int) ([]byte, error) {
+		s := c.rowStripe(row, index)
+		buf := make([]byte, len(dst))
+		if err := dev.ReadDevice(s.DeviceID, buf, s.Offset+offset); err != nil {
+			return nil, fmt.Errorf("stripe %d (device %d): %w", index, s.DeviceID, err)
+		}
+		return buf, nil
+	}
+
+	// Read the other data units of the row; at most one may be missing.
+	data := make([][]byte, nrData)
+	missing := -1
+	for i := range data {
+		if i == target {
+			continue
+		}
+		buf, err := read(i)
+		if err != nil {
+			if missing >= 0 || c.nrParity() == 1 || mirror != 1 {
+				return fmt.Errorf("cannot rebuild logical 0x%x: %w", logical, err)
+			}
+			missing = i
+			continue
+		}
+		data[i] = buf
+	}
+
+	switch {
+	case mirror == 1 && missing < 0:
+		// D_x = P ^ sum(D_i), i != x
+		p, err := read(nrData)
+		if err != nil {
+			return fmt.Errorf("cannot rebuild logical 0x%x: %w", logical, err)
+		}
+		copy(dst, p)
+		for _, d := range data {
+			if d != nil {
+				xorInto(dst, d)
+			}
+		}
+
+	case mirror == 1:
+		// Two data units lost: with P' = D_x ^ D_y and
+		// Q' = g^x*D_x ^ g^y*D_y, D_x = (Q' ^ g^y*P') / (g^x ^ g^y).
+		p, err := read(nrData)
+		if err != nil {
+			return fmt.Errorf("cannot rebuild logical 0x%x: %w", logical, err)
+		}
+		q, err := read(nrData + 1)
+		if err != nil {
+			return fmt.Errorf("cannot rebuild logical 0x%x: %w", logical, err)
+		}
+		for i, d := range data {
+			if d != nil {
+				xorInto(p, d)
+				mulXorInto(q, d, gfPow2(i))
+			}
+		}
+		gy := gfPow2(missing)
+		inv := gfInv(gfPow2(target) ^ gy)
+		for j := range dst {
+			dst[j] = gfMul(q[j]^gfMul(gy, p[j]), inv)
+		}
+
+	case mirror == 2 && c.nrParity() == 2:
+		// D_x = (Q ^ sum(g^i*D_i), i != x) / g^x
+		q, err := read(nrData + 1)
+		if err != nil {
+			return fmt.Errorf("cannot rebuild logical 0x%x: %w", logical, err)
+		}
+		for i, d := range data {
+			if d != nil {
+				mulXorInto(q, d, gfPow2(i))
+			}
+		}
+		inv := gfInv(gfPow2(target))
+		for j := range dst {
+			dst[j] = gfMul(q[j], inv)
+		}
+
+	default:
+		return fmt.Errorf("%w: chunk 0x%x has no copy %d", errors.ErrInvalidChunkMapping, c.LogicalStart, mirror+1)
+	}
+
+	return nil
+}
+
+// xorInto sets dst ^= src.
+func xorInto(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// mulXorInto sets dst ^= coef * src over GF(2^8).
+func mulXorInto(dst, src []byte, coef byte) {
+	for i := range dst {
+		dst[i] ^= gfMul(coef, src[i])
+	}
+}
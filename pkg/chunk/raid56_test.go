@@ -0,0 +1,251 @@
+package chunk
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// memDevices is a set of in-memory devices; a nil entry is a missing device.
+type memDevices map[uint64][]byte
+
+func (d memDevices) ReadDevice(devID uint64, p []byte, offset uint64) error {
+	data := d[devID]
+	if data == nil {
+		return fmt.Errorf("%w: %d", errors.ErrDeviceNotFound, devID)
+	}
+	copy(p, data[offset:])
+	return nil
+}
+
+// slowMul multiplies in GF(2^8) bit by bit, independently of the tables.
+func slowMul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		hi := a & 0x80
+		a <<= 1
+		if hi != 0 {
+			a ^= 0x1d
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// parityLayout is a RAID5/6 chunk with the placement of its first rows
+// written out by hand, following the rotation of the kernel's
+// btrfs_map_block: data unit i of row r is on stripe (i+r) % num_stripes,
+// with P and Q on the stripes after the last data unit. The stripes are not
+// in device ID order and every device has its own stripe offset, so a
+// mix-up of stripe index, device ID and offset shows.
+type parityLayout struct {
+	profile uint64
+	stripes []Stripe
+	rows    [][]uint64 // Device IDs of D0..Dn-1, P and Q for each row
+}
+
+var (
+	raid5Layout = parityLayout{
+		profile: ondisk.BlockGroupRaid5,
+		stripes: []Stripe{{DeviceID: 3, Offset: 0x300000}, {DeviceID: 1, Offset: 0x100000},
+			{DeviceID: 4, Offset: 0x400000}, {DeviceID: 2, Offset: 0x200000}},
+		rows: [][]uint64{
+			{3, 1, 4, 2},
+			{1, 4, 2, 3},
+			{4, 2, 3, 1},
+			{2, 3, 1, 4},
+		},
+	}
+	raid6Layout = parityLayout{
+		profile: ondisk.BlockGroupRaid6,
+		stripes: []Stripe{{DeviceID: 3, Offset: 0x300000}, {DeviceID: 1, Offset: 0x100000},
+			{DeviceID: 5, Offset: 0x500000}, {DeviceID: 2, Offset: 0x200000}, {DeviceID: 4, Offset: 0x400000}},
+		rows: [][]uint64{
+			{3, 1, 5, 2, 4},
+			{1, 5, 2, 4, 3},
+			{5, 2, 4, 3, 1},
+			{2, 4, 3, 1, 5},
+		},
+	}
+)
+
+// nrData returns the number of data units per row.
+func (l parityLayout) nrData() int {
+	if l.profile == ondisk.BlockGroupRaid6 {
+		return len(l.stripes) - 2
+	}
+	return len(l.stripes) - 1
+}
+
+// unitAddr returns the physical address of unit index of a row.
+func (l parityLayout) unitAddr(row, index int) PhysicalAddr {
+	devID := l.rows[row][index]
+	for _, s := range l.stripes {
+		if s.DeviceID == devID {
+			return PhysicalAddr{DeviceID: devID, Offset: s.Offset + uint64(row)*testStripeLen}
+		}
+	}
+	panic(fmt.Sprintf("device %d has no stripe", devID))
+}
+
+// parityArray lays out data, one row of the layout per nr_data stripe
+// units, and returns the chunk and its devices.
+func parityArray(l parityLayout, data []byte) (*ChunkMapping, memDevices) {
+	c := &ChunkMapping{
+		LogicalStart:  0x10000000,
+		LogicalLength: uint64(len(data)),
+		Type:          ondisk.BlockGroupData | l.profile,
+		StripeLen:     testStripeLen,
+		SubStripes:    1,
+		Stripes:       l.stripes,
+	}
+	devs := memDevices{}
+	for _, s := range l.stripes {
+		devs[s.DeviceID] = make([]byte, s.Offset+uint64(len(l.rows))*testStripeLen)
+	}
+	write := func(row, index int, unit []byte) {
+		pa := l.unitAddr(row, index)
+		copy(devs[pa.DeviceID][pa.Offset:], unit)
+	}
+
+	nrData := l.nrData()
+	rowLen := nrData * testStripeLen
+	for row := 0; row*rowLen < len(data); row++ {
+		p := make([]byte, testStripeLen)
+		q := make([]byte, testStripeLen)
+		for i := 0; i < nrData; i++ {
+			unit := data[row*rowLen+i*testStripeLen : row*rowLen+(i+1)*testStripeLen]
+			write(row, i, unit)
+			coef := byte(1)
+			for k := 0; k < i; k++ {
+				coef = slowMul(coef, 2)
+			}
+			for j := range unit {
+				p[j] ^= unit[j]
+				q[j] ^= slowMul(coef, unit[j])
+			}
+		}
+		write(row, nrData, p)
+		if l.profile == ondisk.BlockGroupRaid6 {
+			write(row, nrData+1, q)
+		}
+	}
+	return c, devs
+}
+
+func TestGFTables(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			if got, want := gfMul(byte(a), byte(b)), slowMul(byte(a), byte(b)); got != want {
+				t.Fatalf("gfMul(%d, %d) = %d, want %d", a, b, got, want)
+			}
+		}
+		if a != 0 && gfMul(byte(a), gfInv(byte(a))) != 1 {
+			t.Fatalf("gfInv(%d) is not an inverse", a)
+		}
+	}
+}
+
+func TestRaid56Rebuild(t *testing.T) {
+	data := make([]byte, 4*3*testStripeLen)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// Read 300 bytes across the boundary of the 8th and 9th stripe units,
+	// data units 1 and 2 of the third row.
+	const off = 8*testStripeLen - 100
+	want := data[off : off+300]
+
+	tests := []struct {
+		name    string
+		layout  parityLayout
+		missing []int // indexes into row 2, which contains off
+		mirror  int
+		fail    bool
+	}{
+		{"raid5 direct", raid5Layout, nil, 0, false},
+		{"raid5 from P", raid5Layout, []int{2}, 1, false},
+		{"raid5 two lost", raid5Layout, []int{2, 0}, 1, true},
+		{"raid6 from P", raid6Layout, []int{2}, 1, false},
+		{"raid6 from P and Q", raid6Layout, []int{2, 0}, 1, false},
+		{"raid6 P lost", raid6Layout, []int{2, 3}, 1, true},
+		{"raid6 from Q", raid6Layout, []int{2, 3}, 2, false},
+		{"raid6 no copy 4", raid6Layout, nil, 3, true},
+	}
+
+	for _, tt := range tests {
+		c, devs := parityArray(tt.layout, data)
+		m := NewManager()
+		m.AddMapping(c)
+
+		// Lose whole devices, chosen by their role in the row of off:
+		// 0..nr_data-1 are data units, then P and Q.
+		for _, index := range tt.missing {
+			devs[tt.layout.rows[2][index]] = nil
+		}
+
+		got := make([]byte, len(want))
+		err := m.ReadLogical(devs, c.LogicalStart+off, got, tt.mirror)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: rebuilt data differs", tt.name)
+		}
+	}
+}
+
+func TestRaid56Layout(t *testing.T) {
+	for _, l := range []parityLayout{raid5Layout, raid6Layout} {
+		nrData := l.nrData()
+		data := make([]byte, len(l.rows)*nrData*testStripeLen)
+		rand.New(rand.NewSource(2)).Read(data)
+		c, devs := parityArray(l, data)
+		m := NewManager()
+		m.AddMapping(c)
+
+		for row := range l.rows {
+			for i := 0; i < nrData; i++ {
+				off := uint64(row*nrData+i)*testStripeLen + 0x123
+				want := data[off : off+0x1000]
+
+				// The data has a single location, the one in the table.
+				addrs, err := c.MapMirrors(c.LogicalStart + off)
+				if err != nil {
+					t.Fatalf("profile 0x%x: MapMirrors(0x%x): %v", l.profile, off, err)
+				}
+				pa := l.unitAddr(row, i)
+				pa.Offset += 0x123
+				if len(addrs) != 1 || *addrs[0] != pa {
+					t.Errorf("profile 0x%x: row %d data %d maps to %v, want %+v", l.profile, row, i, addrs, pa)
+				}
+
+				// Every copy rebuilds it once its device is lost.
+				lost := devs[pa.DeviceID]
+				devs[pa.DeviceID] = nil
+				for mirror := 1; mirror < c.NumCopies(); mirror++ {
+					got := make([]byte, len(want))
+					if err := m.ReadLogical(devs, c.LogicalStart+off, got, mirror); err != nil {
+						t.Errorf("profile 0x%x: row %d data %d copy %d: %v", l.profile, row, i, mirror+1, err)
+					} else if !bytes.Equal(got, want) {
+						t.Errorf("profile 0x%x: row %d data %d copy %d: rebuilt data differs", l.profile, row, i, mirror+1)
+					}
+				}
+				devs[pa.DeviceID] = lost
+			}
+		}
+	}
+}
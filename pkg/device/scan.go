@@ -0,0 +1,190 @@
+package device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/logger"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// ScannedDevice is a btrfs member device found by Scan.
+type ScannedDevice struct {
+	Path       string             `json:"path"`
+	DevID      uint64             `json:"devid"`
+	DevUUID    ondisk.UUID        `json:"dev_uuid"`
+	Generation uint64             `json:"generation"`
+	TotalBytes uint64             `json:"total_bytes"` // Size of the device in the filesystem
+	BytesUsed  uint64             `json:"bytes_used"`  // Bytes allocated to chunks on the device
+	Stale      bool               `json:"stale"`       // Older generation than the rest of the filesystem
+	Duplicate  bool               `json:"duplicate"`   // Another file holds the same device, e.g. a second copy
+	Superblock *ondisk.Superblock `json:"-"`           // Newest valid superblock of the device
+}
+
+// ScanGroup is a filesystem found by Scan: the scanned devices that share
+// an FSID.
+type ScanGroup struct {
+	FSID       ondisk.UUID      `json:"fsid"`
+	Label      string           `json:"label"`
+	Generation uint64           `json:"generation"`  // Newest generation of any member
+	NumDevices uint64           `json:"num_devices"` // Members the filesystem has
+	Devices    []*ScannedDevice `json:"devices"`     // Members found, by device ID and newest first
+	Complete   bool             `json:"complete"`    // Every member was found
+}
+
+// Paths returns the paths of the members found, one per device and in
+// device ID order, as fs.OpenDevices takes them.
+func (g *ScanGroup) Paths() []string {
+	var paths []string
+	for _, d := range g.Devices {
+		if !d.Duplicate {
+			paths = append(paths, d.Path)
+		}
+	}
+	return paths
+}
+
+// Found returns how many distinct members of the filesystem were found.
+func (g *ScanGroup) Found() int {
+	return len(g.Paths())
+}
+
+// Missing returns how many members of the filesystem were not found.
+func (g *ScanGroup) Missing() int {
+	if uint64(g.Found()) >= g.NumDevices {
+		return 0
+	}
+	return int(g.NumDevices) - g.Found()
+}
+
+// Scan probes files for btrfs superblocks and groups the members found by
+// filesystem, like btrfs device scan or blkid. Each pattern is a file, a
+// directory, whose entries are probed (not recursively), or a glob as
+// understood by filepath.Glob. Files without a valid superblock are skipped.
+// Groups are returned in the order their first member was found.
+func Scan(patterns ...string) ([]*ScanGroup, error) {
+	paths, err := scanPaths(patterns)
+	if err != nil {
+		return nil, errors.Wrap("Scan", err)
+	}
+
+	var groups []*ScanGroup
+	byFSID := make(map[ondisk.UUID]*ScanGroup)
+	for _, path := range paths {
+		d, err := probe(path)
+		if err != nil {
+			logger.Debug("Scan: skipping %s: %v", path, err)
+			continue
+		}
+
+		fsid := ondisk.UUID(d.Superblock.FSID)
+		g, ok := byFSID[fsid]
+		if !ok {
+			g = &ScanGroup{FSID: fsid}
+			byFSID[fsid] = g
+			groups = append(groups, g)
+		}
+		g.Devices = append(g.Devices, d)
+
+		// The newest member describes the filesystem.
+		if d.Generation >= g.Generation {
+			g.Generation = d.Generation
+			g.Label = d.Superblock.GetLabel()
+			g.NumDevices = d.Superblock.NumDevices
+		}
+	}
+
+	for _, g := range groups {
+		sort.SliceStable(g.Devices, func(i, j int) bool {
+			a, b := g.Devices[i], g.Devices[j]
+			if a.DevID != b.DevID {
+				return a.DevID < b.DevID
+			}
+			return a.Generation > b.Generation
+		})
+		for i, d := range g.Devices {
+			d.Stale = d.Generation < g.Generation
+			d.Duplicate = i > 0 && g.Devices[i-1].DevID == d.DevID
+		}
+		g.Complete = g.Missing() == 0
+	}
+
+	return groups, nil
+}
+
+// scanPaths expands the patterns of Scan into a list of files, without
+// duplicates.
+func scanPaths(patterns []string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		if matches == nil && !strings.ContainsAny(pattern, "*?[") {
+			// Not a glob: report a path that does not exist.
+			if _, err := os.Stat(pattern); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+
+			entries, err := os.ReadDir(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					add(filepath.Join(match, entry.Name()))
+				}
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// probe reads the newest valid superblock of a file.
+func probe(path string) (*ScannedDevice, error) {
+	dev, err := NewFileDevice(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dev.Close()
+
+	sb, err := NewSuperblockReader(dev).ReadLatest()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScannedDevice{
+		Path:       path,
+		DevID:      sb.DevItem.DevID,
+		DevUUID:    ondisk.UUID(sb.DevItem.UUID),
+		Generation: sb.Generation,
+		TotalBytes: sb.DevItem.TotalBytes,
+		BytesUsed:  sb.DevItem.BytesUsed,
+		Superblock: sb,
+	}, nil
+}
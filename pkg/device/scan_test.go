@@ -0,0 +1,83 @@
+package device
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// writeMember writes an image holding only the primary superblock of
+// device devid of the filesystem fsid.
+func writeMember(t *testing.T, path string, fsid byte, devid, numDevices, generation uint64) {
+	t.Helper()
+
+	data := make([]byte, SuperblockOffset+int64(ondisk.SuperblockSize))
+	sb := data[SuperblockOffset:]
+	le := binary.LittleEndian
+	sb[32] = fsid
+	le.PutUint64(sb[48:], uint64(SuperblockOffset))
+	copy(sb[64:], ondisk.BtrfsMagic[:])
+	le.PutUint64(sb[72:], generation)
+	le.PutUint64(sb[112:], 1<<30) // total_bytes
+	le.PutUint64(sb[136:], numDevices)
+	le.PutUint32(sb[144:], 4096)  // sectorsize
+	le.PutUint32(sb[148:], 16384) // nodesize
+	le.PutUint64(sb[201:], devid)
+	sb[201+66] = byte(devid) // dev_item.uuid
+	copy(sb[299:], "scan")
+	sum, _ := ondisk.Checksum(ondisk.CsumTypeCRC32C, sb[ondisk.ChecksumSize:ondisk.SuperblockSize])
+	copy(sb, sum[:])
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	writeMember(t, filepath.Join(dir, "a3.img"), 0xa, 3, 3, 7)
+	writeMember(t, filepath.Join(dir, "a1.img"), 0xa, 1, 3, 7)
+	writeMember(t, filepath.Join(dir, "a2.img"), 0xa, 2, 3, 6)
+	writeMember(t, filepath.Join(dir, "b1.img"), 0xb, 1, 2, 4)
+	writeMember(t, filepath.Join(dir, "b1-copy.img"), 0xb, 1, 2, 4)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not btrfs"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The directory and a glob over the same files find each member once.
+	groups, err := Scan(dir, filepath.Join(dir, "a*.img"))
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("found %d filesystems, want 2", len(groups))
+	}
+
+	a, b := groups[0], groups[1]
+	if a.FSID[0] != 0xa || a.Label != "scan" || a.Generation != 7 || a.NumDevices != 3 || !a.Complete {
+		t.Errorf("first group = %+v", a)
+	}
+	wantPaths := []string{filepath.Join(dir, "a1.img"), filepath.Join(dir, "a2.img"), filepath.Join(dir, "a3.img")}
+	if got := a.Paths(); !reflect.DeepEqual(got, wantPaths) {
+		t.Errorf("Paths = %v, want %v", got, wantPaths)
+	}
+	if !a.Devices[1].Stale || a.Devices[0].Stale || a.Devices[1].DevUUID[0] != 2 {
+		t.Errorf("devices = %+v %+v", a.Devices[0], a.Devices[1])
+	}
+
+	// Two copies of the same device count once.
+	if b.FSID[0] != 0xb || b.Complete || b.Missing() != 1 || len(b.Devices) != 2 || !b.Devices[1].Duplicate {
+		t.Errorf("second group = %+v, %d missing", b, b.Missing())
+	}
+	if got := b.Paths(); len(got) != 1 {
+		t.Errorf("Paths = %v, want one path", got)
+	}
+
+	if _, err := Scan(filepath.Join(dir, "missing.img")); err == nil {
+		t.Error("scanning a path that does not exist should fail")
+	}
+}
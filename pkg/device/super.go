@@ -2,6 +2,7 @@ package device
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 
 	"github.com/WinBeyond/btrfs-read/pkg/errors"
@@ -24,98 +25,167 @@ func NewSuperblockReader(dev BlockDevice) *SuperblockReader {
 	return &SuperblockReader{device: dev}
 }
 
+// SuperblockStatus is the verification result of one superblock copy.
+type SuperblockStatus int
+
+const (
+	SuperblockValid      SuperblockStatus = iota // Passed every check
+	SuperblockBadCsum                            // Checksum mismatch or unknown checksum type
+	SuperblockBadMagic                           // No btrfs magic, e.g. never written
+	SuperblockBadBytenr                          // Records a different offset than it was read from
+	SuperblockInvalid                            // Unreadable or fails a sanity check
+	SuperblockOutOfRange                         // Offset is beyond the end of the device
+)
+
+var superblockStatusNames = [...]string{
+	SuperblockValid:      "valid",
+	SuperblockBadCsum:    "bad-csum",
+	SuperblockBadMagic:   "bad-magic",
+	SuperblockBadBytenr:  "bad-bytenr",
+	SuperblockInvalid:    "invalid",
+	SuperblockOutOfRange: "out-of-range",
+}
+
+func (s SuperblockStatus) String() string {
+	if int(s) < len(superblockStatusNames) {
+		return superblockStatusNames[s]
+	}
+	return fmt.Sprintf("SuperblockStatus(%d)", int(s))
+}
+
+// MarshalText encodes the status by name.
+func (s SuperblockStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// SuperblockCopy is one of the superblock mirrors of a device.
+type SuperblockCopy struct {
+	Index      int                `json:"index"`  // 0 = primary, 1 = backup1 (64MB), 2 = backup2 (256GB)
+	Offset     int64              `json:"offset"` // Byte offset on the device
+	Status     SuperblockStatus   `json:"status"`
+	Err        error              `json:"-"`          // Why the copy is not valid
+	Superblock *ondisk.Superblock `json:"-"`          // Parsed copy, if it could be decoded
+	Generation uint64             `json:"generation"` // Generation of the parsed copy
+}
+
+// superblockOffsets lists the superblock mirror offsets by index.
+var superblockOffsets = []int64{SuperblockOffset, SuperblockBackup1, SuperblockBackup2}
+
 // ReadPrimary reads the primary superblock.
 func (r *SuperblockReader) ReadPrimary() (*ondisk.Superblock, error) {
-	return r.readAt(SuperblockOffset)
+	return r.ReadBackup(0)
 }
 
 // ReadBackup reads a backup superblock at the given index.
 // index: 0 = primary, 1 = backup1 (64MB), 2 = backup2 (256GB)
 func (r *SuperblockReader) ReadBackup(index int) (*ondisk.Superblock, error) {
-	var offset int64
-	switch index {
-	case 0:
-		offset = SuperblockOffset
-	case 1:
-		offset = SuperblockBackup1
-	case 2:
-		offset = SuperblockBackup2
-	default:
+	if index < 0 || index >= len(superblockOffsets) {
 		return nil, fmt.Errorf("invalid backup index: %d", index)
 	}
 
-	if offset >= r.device.Size() {
-		return nil, fmt.Errorf("backup offset %d beyond device size %d", offset, r.device.Size())
+	c := r.readCopy(index)
+	if c.Status != SuperblockValid {
+		return nil, errors.Wrap("SuperblockReader.ReadBackup", c.Err)
 	}
+	return c.Superblock, nil
+}
 
-	return r.readAt(offset)
+// ReadAll reads and verifies every superblock mirror that fits on the
+// device and reports the status of each. It does not fail; problems are
+// recorded per copy.
+func (r *SuperblockReader) ReadAll() []*SuperblockCopy {
+	copies := make([]*SuperblockCopy, len(superblockOffsets))
+	for i := range superblockOffsets {
+		copies[i] = r.readCopy(i)
+	}
+	return copies
 }
 
 // ReadLatest reads the newest valid superblock (primary then backups).
+// Copies that fail verification are skipped, so a torn or corrupted copy
+// is never chosen for its generation.
 func (r *SuperblockReader) ReadLatest() (*ondisk.Superblock, error) {
-	var candidates []*ondisk.Superblock
-	var offsets = []int64{SuperblockOffset, SuperblockBackup1, SuperblockBackup2}
-
-	// Try reading all possible superblocks.
-	for _, offset := range offsets {
-		if offset >= r.device.Size() {
+	var latest *ondisk.Superblock
+	for _, c := range r.ReadAll() {
+		if c.Status != SuperblockValid {
 			continue
 		}
-
-		sb, err := r.readAt(offset)
-		if err != nil {
-			continue // Skip invalid.
-		}
-
-		if err := r.verify(sb); err != nil {
-			continue // Skip failed verification.
+		if latest == nil || c.Superblock.Generation > latest.Generation {
+			latest = c.Superblock
 		}
-
-		candidates = append(candidates, sb)
 	}
 
-	if len(candidates) == 0 {
+	if latest == nil {
 		return nil, errors.ErrNoValidSuperblock
 	}
-
-	// Select the largest generation.
-	latest := candidates[0]
-	for _, sb := range candidates[1:] {
-		if sb.Generation > latest.Generation {
-			latest = sb
-		}
-	}
-
 	return latest, nil
 }
 
-// readAt reads a superblock at the specified offset.
-func (r *SuperblockReader) readAt(offset int64) (*ondisk.Superblock, error) {
+// readCopy reads and verifies the superblock mirror at the given index.
+func (r *SuperblockReader) readCopy(index int) *SuperblockCopy {
+	offset := superblockOffsets[index]
+	c := &SuperblockCopy{Index: index, Offset: offset}
+
+	if offset+int64(ondisk.SuperblockSize) > r.device.Size() {
+		c.Status = SuperblockOutOfRange
+		c.Err = fmt.Errorf("superblock offset %d beyond device size %d", offset, r.device.Size())
+		return c
+	}
+
 	buf := make([]byte, ondisk.SuperblockSize)
 	n, err := r.device.ReadAt(buf, offset)
+	if err == nil && n != ondisk.SuperblockSize {
+		err = fmt.Errorf("read %d bytes, expected %d", n, ondisk.SuperblockSize)
+	}
 	if err != nil {
-		return nil, errors.Wrap("SuperblockReader.readAt", err)
+		c.Status = SuperblockInvalid
+		c.Err = errors.Wrap("SuperblockReader.readAt", err)
+		return c
 	}
-	if n != ondisk.SuperblockSize {
-		return nil, errors.Wrap("SuperblockReader.readAt",
-			fmt.Errorf("read %d bytes, expected %d", n, ondisk.SuperblockSize))
+
+	// Magic: csum (32) + fsid (16) + bytenr (8) + flags (8).
+	if !bytes.Equal(buf[64:72], ondisk.BtrfsMagic[:]) {
+		c.Status = SuperblockBadMagic
+		c.Err = errors.ErrInvalidMagic
+		return c
+	}
+
+	// The checksum covers everything after the csum field, including the
+	// csum_type it is computed with (offset 196).
+	csumType := binary.LittleEndian.Uint16(buf[196:198])
+	if err := ondisk.VerifyChecksum(csumType, buf); err != nil {
+		c.Status = SuperblockBadCsum
+		c.Err = fmt.Errorf("%w: superblock at %d: %v", errors.ErrInvalidChecksum, offset, err)
+		return c
 	}
 
 	sb := &ondisk.Superblock{}
 	if err := sb.Unmarshal(buf); err != nil {
-		return nil, errors.Wrap("SuperblockReader.Unmarshal", err)
+		c.Status = SuperblockInvalid
+		c.Err = errors.Wrap("SuperblockReader.Unmarshal", err)
+		return c
 	}
+	c.Superblock = sb
+	c.Generation = sb.Generation
 
-	return sb, nil
-}
+	if sb.Bytenr != uint64(offset) {
+		c.Status = SuperblockBadBytenr
+		c.Err = fmt.Errorf("superblock at %d records bytenr %d", offset, sb.Bytenr)
+		return c
+	}
 
-// verify validates the superblock.
-func (r *SuperblockReader) verify(sb *ondisk.Superblock) error {
-	// Validate magic number.
-	if !bytes.Equal(sb.Magic[:], ondisk.BtrfsMagic[:]) {
-		return errors.ErrInvalidMagic
+	if err := r.verify(sb); err != nil {
+		c.Status = SuperblockInvalid
+		c.Err = err
+		return c
 	}
 
+	c.Status = SuperblockValid
+	return c
+}
+
+// verify validates the superblock fields.
+func (r *SuperblockReader) verify(sb *ondisk.Superblock) error {
 	// Validate basic fields.
 	if sb.SectorSize == 0 {
 		return fmt.Errorf("invalid sector size: 0")
@@ -127,7 +197,5 @@ func (r *SuperblockReader) verify(sb *ondisk.Superblock) error {
 		return fmt.Errorf("invalid total bytes: 0")
 	}
 
-	// TODO: Validate CRC32C checksum (requires checksum.go).
-
 	return nil
 }
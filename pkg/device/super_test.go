@@ -0,0 +1,102 @@
+package device
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// memDevice is an in-memory block device.
+type memDevice struct {
+	data []byte
+}
+
+func (d *memDevice) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, d.data[off:]), nil
+}
+
+func (d *memDevice) Size() int64      { return int64(len(d.data)) }
+func (d *memDevice) DeviceID() uint64 { return 1 }
+func (d *memDevice) Close() error     { return nil }
+
+// writeSuperblock stores a checksummed superblock copy at offset.
+func writeSuperblock(dev *memDevice, offset int64, bytenr uint64, generation uint64, csumType uint16) {
+	sb := make([]byte, ondisk.SuperblockSize)
+	le := binary.LittleEndian
+	le.PutUint64(sb[48:], bytenr)
+	copy(sb[64:], ondisk.BtrfsMagic[:])
+	le.PutUint64(sb[72:], generation)
+	le.PutUint64(sb[112:], uint64(len(dev.data))) // total_bytes
+	le.PutUint32(sb[144:], 4096)                  // sectorsize
+	le.PutUint32(sb[148:], 16384)                 // nodesize
+	le.PutUint16(sb[196:], csumType)
+	sum, _ := ondisk.Checksum(csumType, sb[ondisk.ChecksumSize:])
+	copy(sb, sum[:])
+	copy(dev.data[offset:], sb)
+}
+
+func TestReadAllSuperblocks(t *testing.T) {
+	dev := &memDevice{data: make([]byte, SuperblockBackup1+int64(ondisk.SuperblockSize))}
+	writeSuperblock(dev, SuperblockOffset, uint64(SuperblockOffset), 5, ondisk.CsumTypeSHA256)
+	writeSuperblock(dev, SuperblockBackup1, uint64(SuperblockBackup1), 9, ondisk.CsumTypeSHA256)
+
+	// A torn write of the newer backup must not win on generation.
+	dev.data[SuperblockBackup1+1000] ^= 0xff
+
+	r := NewSuperblockReader(dev)
+	copies := r.ReadAll()
+	want := []SuperblockStatus{SuperblockValid, SuperblockBadCsum, SuperblockOutOfRange}
+	if len(copies) != len(want) {
+		t.Fatalf("ReadAll returned %d copies, want %d", len(copies), len(want))
+	}
+	for i, c := range copies {
+		if c.Status != want[i] {
+			t.Errorf("copy %d: status %s (%v), want %s", i, c.Status, c.Err, want[i])
+		}
+	}
+	if !errors.Is(copies[1].Err, errors.ErrInvalidChecksum) {
+		t.Errorf("copy 1: expected ErrInvalidChecksum, got %v", copies[1].Err)
+	}
+
+	sb, err := r.ReadLatest()
+	if err != nil {
+		t.Fatalf("ReadLatest failed: %v", err)
+	}
+	if sb.Generation != 5 {
+		t.Errorf("ReadLatest chose generation %d, want 5", sb.Generation)
+	}
+
+	if _, err := r.ReadBackup(1); err == nil {
+		t.Error("ReadBackup(1) should fail for a corrupted copy")
+	}
+}
+
+func TestReadAllSuperblocksBadBytenrAndMagic(t *testing.T) {
+	dev := &memDevice{data: make([]byte, SuperblockBackup1+int64(ondisk.SuperblockSize))}
+
+	// A valid copy of the primary stored at the backup offset, e.g. by a
+	// misdirected write or a careless dd.
+	writeSuperblock(dev, SuperblockBackup1, uint64(SuperblockOffset), 9, ondisk.CsumTypeCRC32C)
+
+	copies := NewSuperblockReader(dev).ReadAll()
+	if copies[0].Status != SuperblockBadMagic {
+		t.Errorf("copy 0: status %s, want bad-magic", copies[0].Status)
+	}
+	if copies[1].Status != SuperblockBadBytenr {
+		t.Errorf("copy 1: status %s, want bad-bytenr", copies[1].Status)
+	}
+
+	if _, err := NewSuperblockReader(dev).ReadLatest(); !errors.Is(err, errors.ErrNoValidSuperblock) {
+		t.Errorf("Expected ErrNoValidSuperblock, got %v", err)
+	}
+}
+
+func TestSuperblockStatusString(t *testing.T) {
+	text, _ := SuperblockBadCsum.MarshalText()
+	if !bytes.Equal(text, []byte("bad-csum")) {
+		t.Errorf("MarshalText = %s, want bad-csum", text)
+	}
+}
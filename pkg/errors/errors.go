@@ -37,6 +37,12 @@ var (
 	ErrInodeNotFound   = errors.New("inode not found")
 	ErrInvalidFilePath = errors.New("invalid file path")
 	ErrExtentNotFound  = errors.New("extent not found")
+	ErrNotSymlink      = errors.New("not a symbolic link")
+	ErrSymlinkLoop     = errors.New("too many levels of symbolic links")
+	ErrXattrNotFound   = errors.New("extended attribute not found")
+
+	// Subvolume-related errors.
+	ErrSubvolumeNotFound = errors.New("subvolume not found")
 
 	// Compression-related errors.
 	ErrUnsupportedCompression = errors.New("unsupported compression type")
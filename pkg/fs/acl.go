@@ -0,0 +1,125 @@
+package fs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// POSIX ACL extended attribute names.
+const (
+	XattrACLAccess  = "system.posix_acl_access"
+	XattrACLDefault = "system.posix_acl_default"
+)
+
+// posixACLVersion is the only version of the ACL xattr format.
+const posixACLVersion = 2
+
+// ACLTag is the type of a POSIX ACL entry.
+type ACLTag uint16
+
+// ACL entry tags (ACL_USER_OBJ etc.).
+const (
+	ACLUserObj  ACLTag = 0x01
+	ACLUser     ACLTag = 0x02
+	ACLGroupObj ACLTag = 0x04
+	ACLGroup    ACLTag = 0x08
+	ACLMask     ACLTag = 0x10
+	ACLOther    ACLTag = 0x20
+)
+
+// String returns the tag name used in getfacl output.
+func (t ACLTag) String() string {
+	switch t {
+	case ACLUserObj, ACLUser:
+		return "user"
+	case ACLGroupObj, ACLGroup:
+		return "group"
+	case ACLMask:
+		return "mask"
+	case ACLOther:
+		return "other"
+	}
+	return fmt.Sprintf("tag(0x%x)", uint16(t))
+}
+
+// ACLEntry is one entry of a POSIX ACL.
+type ACLEntry struct {
+	Tag  ACLTag
+	ID   uint32 // UID for ACLUser, GID for ACLGroup; unused otherwise.
+	Perm uint16 // Bits 4 (read), 2 (write) and 1 (execute).
+}
+
+// HasID reports whether the entry names a specific user or group.
+func (e ACLEntry) HasID() bool {
+	return e.Tag == ACLUser || e.Tag == ACLGroup
+}
+
+// String formats the entry like getfacl, e.g. "user:1000:r-x".
+func (e ACLEntry) String() string {
+	qualifier := ""
+	if e.HasID() {
+		qualifier = strconv.FormatUint(uint64(e.ID), 10)
+	}
+	return e.Tag.String() + ":" + qualifier + ":" + FormatACLPerm(e.Perm)
+}
+
+// FormatACLPerm formats permission bits as "rwx" with dashes for unset bits.
+func FormatACLPerm(perm uint16) string {
+	b := []byte("---")
+	if perm&4 != 0 {
+		b[0] = 'r'
+	}
+	if perm&2 != 0 {
+		b[1] = 'w'
+	}
+	if perm&1 != 0 {
+		b[2] = 'x'
+	}
+	return string(b)
+}
+
+// ParseACL decodes a system.posix_acl_access or system.posix_acl_default
+// value: a 4-byte version followed by 8-byte entries of tag (2), perm (2)
+// and id (4).
+func ParseACL(data []byte) ([]ACLEntry, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("ACL too short: %d bytes", len(data))
+	}
+	if version := binary.LittleEndian.Uint32(data[0:4]); version != posixACLVersion {
+		return nil, fmt.Errorf("unsupported ACL version %d", version)
+	}
+	if (len(data)-4)%8 != 0 {
+		return nil, fmt.Errorf("ACL size %d is not a whole number of entries", len(data))
+	}
+
+	entries := make([]ACLEntry, 0, (len(data)-4)/8)
+	for off := 4; off < len(data); off += 8 {
+		entries = append(entries, ACLEntry{
+			Tag:  ACLTag(binary.LittleEndian.Uint16(data[off : off+2])),
+			Perm: binary.LittleEndian.Uint16(data[off+2 : off+4]),
+			ID:   binary.LittleEndian.Uint32(data[off+4 : off+8]),
+		})
+	}
+	return entries, nil
+}
+
+// GetACL returns the access ACL of a file, or its default ACL if
+// defaultACL is set. It returns ErrXattrNotFound if the file has none.
+func (fs *FileSystem) GetACL(path string, defaultACL bool) ([]ACLEntry, error) {
+	name := XattrACLAccess
+	if defaultACL {
+		name = XattrACLDefault
+	}
+
+	data, err := fs.GetXattr(path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ParseACL(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", path, name, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,68 @@
+package fs
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func encodeACL(entries ...ACLEntry) []byte {
+	data := make([]byte, 4+8*len(entries))
+	binary.LittleEndian.PutUint32(data, posixACLVersion)
+	for i, e := range entries {
+		off := 4 + 8*i
+		binary.LittleEndian.PutUint16(data[off:], uint16(e.Tag))
+		binary.LittleEndian.PutUint16(data[off+2:], e.Perm)
+		binary.LittleEndian.PutUint32(data[off+4:], e.ID)
+	}
+	return data
+}
+
+func TestParseACL(t *testing.T) {
+	const undefinedID = 0xffffffff
+	data := encodeACL(
+		ACLEntry{Tag: ACLUserObj, Perm: 6, ID: undefinedID},
+		ACLEntry{Tag: ACLUser, Perm: 4, ID: 1000},
+		ACLEntry{Tag: ACLGroupObj, Perm: 5, ID: undefinedID},
+		ACLEntry{Tag: ACLGroup, Perm: 7, ID: 100},
+		ACLEntry{Tag: ACLMask, Perm: 5, ID: undefinedID},
+		ACLEntry{Tag: ACLOther, Perm: 0, ID: undefinedID},
+	)
+
+	entries, err := ParseACL(data)
+	if err != nil {
+		t.Fatalf("ParseACL failed: %v", err)
+	}
+
+	want := []string{
+		"user::rw-",
+		"user:1000:r--",
+		"group::r-x",
+		"group:100:rwx",
+		"mask::r-x",
+		"other::---",
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.String() != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, e.String(), want[i])
+		}
+	}
+}
+
+func TestParseACLInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad version", []byte{1, 0, 0, 0}},
+		{"partial entry", append(encodeACL(ACLEntry{Tag: ACLOther}), 1, 2)},
+	}
+	for _, tt := range tests {
+		if _, err := ParseACL(tt.data); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package fs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	gopath "path"
+	"sort"
+
+	"github.com/WinBeyond/btrfs-read/pkg/btree"
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/logger"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// LogicalInode is a file referencing the data at a logical address, as
+// found by LogicalResolve.
+type LogicalInode struct {
+	Root   uint64   `json:"root"` // Subvolume holding the inode
+	Inode  uint64   `json:"inode"`
+	Offset uint64   `json:"offset"` // Offset of the address in the file
+	Paths  []string `json:"paths"`  // Paths from the top-level subvolume, one per hard link
+}
+
+// extentBackrefs is an extent of the extent tree with all its back
+// references, inline and keyed.
+type extentBackrefs struct {
+	bytenr uint64
+	length uint64
+	item   ondisk.ExtentItem
+	refs   []ondisk.ExtentRef
+}
+
+// LogicalResolve finds the files whose data is stored at a logical address,
+// like btrfs inspect-internal logical-resolve: the back references of the
+// data extent containing the address lead to the inodes referencing it, in
+// every subvolume and snapshot sharing it. Inodes are sorted by root, inode
+// and offset; an inode whose path cannot be built has no Paths. It fails
+// with ErrExtentNotFound when the address is free space or metadata.
+func (fs *FileSystem) LogicalResolve(logical uint64) ([]*LogicalInode, error) {
+	root, err := fs.readRootItem(ondisk.ExtentTreeObjectid)
+	if err != nil {
+		return nil, errors.Wrap("LogicalResolve", fmt.Errorf("failed to read extent tree root: %w", err))
+	}
+	extentRoot := root.ByteNr
+
+	extent, err := fs.lookupExtent(extentRoot, logical)
+	if err != nil {
+		return nil, errors.Wrap("LogicalResolve", err)
+	}
+	if extent.item.Flags&ondisk.ExtentFlagTreeBlock != 0 {
+		return nil, errors.Wrap("LogicalResolve", fmt.Errorf("%w: logical 0x%x is in tree block 0x%x (level %d), not file data",
+			errors.ErrExtentNotFound, logical, extent.bytenr, extent.item.Level))
+	}
+
+	var inodes []*LogicalInode
+	seen := make(map[[3]uint64]bool)
+	add := func(root, ino, offset uint64) {
+		key := [3]uint64{root, ino, offset}
+		if !seen[key] {
+			seen[key] = true
+			inodes = append(inodes, &LogicalInode{Root: root, Inode: ino, Offset: offset})
+		}
+	}
+
+	for _, ref := range extent.refs {
+		switch ref.Type {
+		case ondisk.KeyTypeExtentDataRef:
+			err = fs.resolveDataRef(extent, logical, ref, add)
+		case ondisk.KeyTypeSharedDataRef:
+			err = fs.resolveSharedDataRef(extentRoot, extent, logical, ref, add)
+		}
+		if err != nil {
+			return nil, errors.Wrap("LogicalResolve", err)
+		}
+	}
+
+	sort.Slice(inodes, func(i, j int) bool {
+		a, b := inodes[i], inodes[j]
+		if a.Root != b.Root {
+			return a.Root < b.Root
+		}
+		if a.Inode != b.Inode {
+			return a.Inode < b.Inode
+		}
+		return a.Offset < b.Offset
+	})
+
+	fs.resolveInodePaths(inodes)
+	return inodes, nil
+}
+
+// lookupExtent finds the EXTENT_ITEM or METADATA_ITEM containing a logical
+// address and reads its back references.
+func (fs *FileSystem) lookupExtent(extentRoot uint64, logical uint64) (*extentBackrefs, error) {
+	notFound := fmt.Errorf("%w: logical 0x%x is not in an allocated extent", errors.ErrExtentNotFound, logical)
+
+	// The candidate is the last extent item at or before the address;
+	// keyed back references and block group items sort between them.
+	key := &btree.Key{ObjectID: logical, Type: ondisk.KeyTypeMetadataItem, Offset: math.MaxUint64}
+	c := fs.btreeSearcher.NewCursor(extentRoot)
+	ok, err := c.Seek(key)
+	if err == nil && (!ok || c.Item().Key.Compare(key) != 0) {
+		ok, err = c.Prev()
+	}
+	for ; ok && err == nil; ok, err = c.Prev() {
+		if t := c.Item().Key.Type; t == ondisk.KeyTypeExtentItem || t == ondisk.KeyTypeMetadataItem {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, notFound
+	}
+
+	item := c.Item()
+	extent := &extentBackrefs{bytenr: item.Key.ObjectID, length: item.Key.Offset}
+	if item.Key.Type == ondisk.KeyTypeMetadataItem {
+		extent.length = uint64(fs.superblock.NodeSize)
+	}
+	if logical >= extent.bytenr+extent.length {
+		return nil, notFound
+	}
+
+	if err := extent.item.Unmarshal(item.Data, item.Key.Type, item.Key.Offset); err != nil {
+		return nil, fmt.Errorf("extent item 0x%x: %w", extent.bytenr, err)
+	}
+	extent.refs = append(extent.refs, extent.item.InlineRefs...)
+
+	// Keyed back references follow the extent item.
+	for ok, err = c.Next(); ok && err == nil; ok, err = c.Next() {
+		k := c.Item().Key
+		if k.ObjectID != extent.bytenr || !ondisk.IsBackref(k.Type) {
+			break
+		}
+
+		var ref ondisk.ExtentRef
+		if err := ref.Unmarshal(c.Item().Data, k.Type, k.Offset); err != nil {
+			logger.Warn("Failed to parse back reference (0x%x, %d, 0x%x): %v", k.ObjectID, k.Type, k.Offset, err)
+			continue
+		}
+		extent.refs = append(extent.refs, ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return extent, nil
+}
+
+// resolveDataRef finds the file extent items an EXTENT_DATA_REF stands
+// for: the EXTENT_DATA items of the inode pointing to the extent from the
+// ref offset on, in the subvolume named by the ref.
+func (fs *FileSystem) resolveDataRef(extent *extentBackrefs, logical uint64, ref ondisk.ExtentRef, add func(root, ino, offset uint64)) error {
+	root, err := fs.readRootItem(ref.Root)
+	if errors.Is(err, errors.ErrSubvolumeNotFound) {
+		// The subvolume is deleted but not yet cleaned up.
+		logger.Debug("Skipping data ref of extent 0x%x in root %d: %v", extent.bytenr, ref.Root, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// The ref offset wraps below zero for an item at a file offset smaller
+	// than its offset into the extent, e.g. a clone of the extent's tail to
+	// the start of a file; such items are searched from the start.
+	start := ref.Offset
+	if start >= math.MaxInt64 {
+		start = 0
+	}
+
+	found := uint32(0)
+	key := &btree.Key{ObjectID: ref.Objectid, Type: ondisk.KeyTypeExtentData, Offset: start}
+	return fs.btreeSearcher.Walk(root.ByteNr, key, func(item *btree.Item) (bool, error) {
+		if item.Key.ObjectID != ref.Objectid || item.Key.Type != ondisk.KeyTypeExtentData {
+			return false, nil
+		}
+
+		fe, ok := parseDiskExtent(item.Data)
+		if !ok || fe.bytenr != extent.bytenr || item.Key.Offset-fe.offset != ref.Offset {
+			return true, nil
+		}
+		if offset, ok := fe.fileOffset(item.Key.Offset, logical); ok {
+			add(ref.Root, ref.Objectid, offset)
+		}
+
+		found++
+		return found < ref.Count, nil
+	})
+}
+
+// resolveSharedDataRef finds the file extent items a SHARED_DATA_REF stands
+// for: the EXTENT_DATA items pointing to the extent in the parent leaf,
+// which belongs to every subvolume that references the leaf.
+func (fs *FileSystem) resolveSharedDataRef(extentRoot uint64, extent *extentBackrefs, logical uint64, ref ondisk.ExtentRef, add func(root, ino, offset uint64)) error {
+	leaf, err := fs.ReadNode(ref.Parent, fs.superblock.NodeSize)
+	if err != nil {
+		return fmt.Errorf("leaf 0x%x referencing extent 0x%x: %w", ref.Parent, extent.bytenr, err)
+	}
+	if !leaf.Header.IsLeaf() {
+		return fmt.Errorf("%w: block 0x%x referencing extent 0x%x is not a leaf", errors.ErrInvalidNode, ref.Parent, extent.bytenr)
+	}
+
+	roots := fs.treeBlockRoots(extentRoot, ref.Parent, make(map[uint64]bool))
+	for _, item := range leaf.Items {
+		if item.Key.Type != ondisk.KeyTypeExtentData {
+			continue
+		}
+		fe, ok := parseDiskExtent(item.Data)
+		if !ok || fe.bytenr != extent.bytenr {
+			continue
+		}
+		if offset, ok := fe.fileOffset(item.Key.Offset, logical); ok {
+			for _, root := range roots {
+				add(root, item.Key.ObjectID, offset)
+			}
+		}
+	}
+	return nil
+}
+
+// treeBlockRoots returns the subvolumes referencing a tree block, following
+// SHARED_BLOCK_REFs up through its parents. A block without usable back
+// references is attributed to the owner in its header.
+func (fs *FileSystem) treeBlockRoots(extentRoot uint64, bytenr uint64, visited map[uint64]bool) []uint64 {
+	if visited[bytenr] {
+		return nil
+	}
+	visited[bytenr] = true
+
+	var roots []uint64
+	extent, err := fs.lookupExtent(extentRoot, bytenr)
+	if err == nil && extent.bytenr == bytenr {
+		for _, ref := range extent.refs {
+			switch ref.Type {
+			case ondisk.KeyTypeTreeBlockRef:
+				roots = append(roots, ref.Root)
+			case ondisk.KeyTypeSharedBlockRef:
+				roots = append(roots, fs.treeBlockRoots(extentRoot, ref.Parent, visited)...)
+			}
+		}
+	} else {
+		logger.Debug("No extent item for tree block 0x%x: %v", bytenr, err)
+	}
+
+	if len(roots) == 0 {
+		node, err := fs.ReadNode(bytenr, fs.superblock.NodeSize)
+		if err != nil {
+			logger.Warn("Cannot find the owner of tree block 0x%x: %v", bytenr, err)
+			return nil
+		}
+		roots = append(roots, node.Header.Owner)
+	}
+
+	// Only subvolumes hold files; relocation trees and the like do not.
+	var subvols []uint64
+	for _, root := range roots {
+		if root == ondisk.FsTreeObjectid || (root >= ondisk.FirstFreeObjectid && root <= ondisk.LastFreeObjectid) {
+			subvols = append(subvols, root)
+		}
+	}
+	return subvols
+}
+
+// resolveInodePaths fills in the paths of the inodes found by
+// LogicalResolve, prefixed with the path of their subvolume.
+func (fs *FileSystem) resolveInodePaths(inodes []*LogicalInode) {
+	var subvolPaths map[uint64]string
+	for _, inode := range inodes {
+		prefix := "/"
+		if inode.Root != ondisk.FsTreeObjectid {
+			if subvolPaths == nil {
+				subvolPaths = make(map[uint64]string)
+				subvols, err := fs.ListSubvolumes()
+				if err != nil {
+					logger.Warn("Failed to list subvolumes: %v", err)
+				}
+				for _, sv := range subvols {
+					subvolPaths[sv.ID] = sv.Path
+				}
+			}
+			path, ok := subvolPaths[inode.Root]
+			if !ok {
+				logger.Warn("Subvolume %d of inode %d is not linked, cannot build its path", inode.Root, inode.Inode)
+				continue
+			}
+			prefix = "/" + path
+		}
+
+		root, err := fs.readRootItem(inode.Root)
+		if err != nil {
+			logger.Warn("Cannot build the path of inode %d in root %d: %v", inode.Inode, inode.Root, err)
+			continue
+		}
+		paths, err := fs.inodePaths(root.ByteNr, inode.Inode)
+		if err != nil {
+			logger.Warn("Cannot build the path of inode %d in root %d: %v", inode.Inode, inode.Root, err)
+			continue
+		}
+		for _, p := range paths {
+			inode.Paths = append(inode.Paths, gopath.Join(prefix, p))
+		}
+	}
+}
+
+// inodePaths returns every path of an inode relative to the root directory
+// of the tree at treeRoot, one per hard link, from its INODE_REF and
+// INODE_EXTREF items. The paths are sorted.
+func (fs *FileSystem) inodePaths(treeRoot uint64, ino uint64) ([]string, error) {
+	type link struct {
+		parent uint64
+		name   string
+	}
+	var links []link
+
+	key := &btree.Key{ObjectID: ino, Type: ondisk.KeyTypeInodeRef}
+	err := fs.btreeSearcher.Walk(treeRoot, key, func(item *btree.Item) (bool, error) {
+		if item.Key.ObjectID != ino || item.Key.Type > ondisk.KeyTypeInodeExtref {
+			return false, nil
+		}
+
+		// INODE_REF: (index (8) + name_len (2) + name)*, keyed by parent.
+		// INODE_EXTREF: (parent (8) + index (8) + name_len (2) + name)*,
+		// keyed by a hash of parent and name.
+		data := item.Data
+		for len(data) > 0 {
+			parent := item.Key.Offset
+			if item.Key.Type == ondisk.KeyTypeInodeExtref {
+				if len(data) < 8 {
+					return false, fmt.Errorf("inode %d INODE_EXTREF too short", ino)
+				}
+				parent = binary.LittleEndian.Uint64(data[0:8])
+				data = data[8:]
+			}
+			if len(data) < 10 {
+				return false, fmt.Errorf("inode %d back reference too short", ino)
+			}
+			nameLen := int(binary.LittleEndian.Uint16(data[8:10]))
+			if len(data) < 10+nameLen {
+				return false, fmt.Errorf("inode %d back reference name out of bounds", ino)
+			}
+			links = append(links, link{parent: parent, name: string(data[10 : 10+nameLen])})
+			data = data[10+nameLen:]
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("inode %d has no INODE_REF", ino)
+	}
+
+	paths := make([]string, 0, len(links))
+	for _, l := range links {
+		dir, err := fs.inodePath(treeRoot, l.parent)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, gopath.Join(dir, l.name))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// diskExtent is the part of a REG or PREALLOC EXTENT_DATA item locating its
+// data in a disk extent.
+type diskExtent struct {
+	bytenr     uint64 // Start of the disk extent
+	offset     uint64 // Offset of the file data into the decoded extent
+	numBytes   uint64 // File bytes the item covers
+	compressed bool
+}
+
+// parseDiskExtent decodes the disk extent an EXTENT_DATA item points to.
+// It returns false for inline extents and holes.
+func parseDiskExtent(data []byte) (*diskExtent, bool) {
+	if len(data) < 53 || data[20] == ondisk.FileExtentInline {
+		return nil, false
+	}
+
+	le := binary.LittleEndian
+	fe := &diskExtent{
+		bytenr:     le.Uint64(data[21:29]),
+		offset:     le.Uint64(data[37:45]),
+		numBytes:   le.Uint64(data[45:53]),
+		compressed: data[16] != ondisk.CompressNone,
+	}
+	return fe, fe.bytenr != 0
+}
+
+// fileOffset returns the file offset of a logical address in the disk
+// extent, for an item at file offset itemOffset. It returns false if the
+// item does not cover the address. The data of a compressed extent is not
+// addressable by position, so the whole item covers every address of it,
+// at the item's offset.
+func (fe *diskExtent) fileOffset(itemOffset uint64, logical uint64) (uint64, bool) {
+	if fe.compressed {
+		return itemOffset, true
+	}
+	start := fe.bytenr + fe.offset
+	if logical < start || logical >= start+fe.numBytes {
+		return 0, false
+	}
+	return itemOffset + (logical - start), true
+}
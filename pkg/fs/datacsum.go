@@ -0,0 +1,91 @@
+package fs
+
+import (
+	"fmt"
+
+	"github.com/WinBeyond/btrfs-read/pkg/btree"
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// lookupDataCsums returns the checksum of each sector in the sector-aligned
+// logical range [start, start+length) from the csum tree. Sectors without a
+// checksum (nodatasum files, or no csum tree at all) get nil.
+//
+// EXTENT_CSUM items are keyed (EXTENT_CSUM_OBJECTID, EXTENT_CSUM, bytenr)
+// and hold the checksums of consecutive sectors starting at bytenr.
+func (fs *FileSystem) lookupDataCsums(start uint64, length uint64) ([][]byte, error) {
+	sectorSize := uint64(fs.superblock.SectorSize)
+	csumSize := uint64(ondisk.CsumSize(fs.superblock.CsumType))
+	if fs.csumRoot == 0 || csumSize == 0 {
+		return nil, nil
+	}
+
+	csums := make([][]byte, length/sectorSize)
+	end := start + length
+
+	key := &btree.Key{
+		ObjectID: ondisk.ExtentCsumObjectid,
+		Type:     ondisk.KeyTypeExtentCsum,
+		Offset:   start,
+	}
+
+	c := fs.btreeSearcher.NewCursor(fs.csumRoot)
+	ok, err := c.Seek(key)
+	if err == nil && (!ok || c.Item().Key.Compare(key) != 0) {
+		// The item covering start may begin before it.
+		if ok, err = c.Prev(); err == nil && !ok {
+			ok, err = c.Next()
+		}
+	}
+
+	for ; ok && err == nil; ok, err = c.Next() {
+		item := c.Item()
+		if item.Key.ObjectID != ondisk.ExtentCsumObjectid || item.Key.Type != ondisk.KeyTypeExtentCsum {
+			if item.Key.Compare(key) < 0 {
+				continue
+			}
+			break
+		}
+		if item.Key.Offset >= end {
+			break
+		}
+
+		for i := uint64(0); (i+1)*csumSize <= uint64(len(item.Data)); i++ {
+			sector := item.Key.Offset + i*sectorSize
+			if sector >= end {
+				break
+			}
+			if sector >= start {
+				csums[(sector-start)/sectorSize] = item.Data[i*csumSize : (i+1)*csumSize]
+			}
+		}
+	}
+
+	return csums, err
+}
+
+// verifyData checks each sector of buf, read from logical address start,
+// against the checksums returned by lookupDataCsums.
+func (fs *FileSystem) verifyData(start uint64, buf []byte, csums [][]byte) error {
+	sectorSize := uint64(fs.superblock.SectorSize)
+
+	for i, want := range csums {
+		if want == nil {
+			continue
+		}
+
+		sector := buf[uint64(i)*sectorSize : uint64(i+1)*sectorSize]
+		sum, err := ondisk.Checksum(fs.superblock.CsumType, sector)
+		if err != nil {
+			return err
+		}
+		if string(sum[:len(want)]) != string(want) {
+			return fmt.Errorf("%w: data sector 0x%x: %s mismatch: stored %x, computed %x",
+				errors.ErrInvalidChecksum, start+uint64(i)*sectorSize,
+				ondisk.CsumName(fs.superblock.CsumType), want, sum[:len(want)])
+		}
+	}
+
+	return nil
+}
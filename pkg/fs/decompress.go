@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// lzoHeaderLen is the size of the length fields in btrfs LZO framing.
+const lzoHeaderLen = 4
+
+// decompress decodes an extent compressed with the given algorithm.
+// The result is always ramBytes long; a stream that ends early is zero-filled,
+// matching the kernel.
+func decompress(compression uint8, src []byte, ramBytes uint64, sectorSize uint32) ([]byte, error) {
+	switch compression {
+	case ondisk.CompressZlib:
+		r, err := zlib.NewReader(bytes.NewReader(src))
+		if err != nil {
+			return nil, fmt.Errorf("%w: zlib: %v", errors.ErrDecompressionFailed, err)
+		}
+		defer r.Close()
+		return readDecompressed(r, ramBytes, "zlib")
+
+	case ondisk.CompressZstd:
+		// Extents are zero-padded to the sector size, so decode as a stream
+		// and stop after ram_bytes instead of expecting a single frame.
+		r, err := zstd.NewReader(bytes.NewReader(src), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: zstd: %v", errors.ErrDecompressionFailed, err)
+		}
+		defer r.Close()
+		return readDecompressed(r, ramBytes, "zstd")
+
+	case ondisk.CompressLZO:
+		return decompressLZO(src, ramBytes, sectorSize)
+	}
+
+	return nil, fmt.Errorf("%w: %d", errors.ErrUnsupportedCompression, compression)
+}
+
+// readDecompressed reads up to size bytes from a decompressing reader.
+// A stream that ends cleanly before size bytes leaves the tail zero-filled.
+func readDecompressed(r io.Reader, size uint64, algorithm string) ([]byte, error) {
+	out := make([]byte, size)
+	total := 0
+	for total < len(out) {
+		n, err := r.Read(out[total:])
+		total += n
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errors.ErrDecompressionFailed, algorithm, err)
+		}
+	}
+	return out, nil
+}
+
+// decompressLZO decodes btrfs LZO framing: a 4-byte total length followed by
+// segments, each a 4-byte length plus an LZO1X stream of at most one sector.
+// A segment header never crosses a sector boundary; the gap is zero padding.
+func decompressLZO(src []byte, ramBytes uint64, sectorSize uint32) ([]byte, error) {
+	if len(src) < lzoHeaderLen {
+		return nil, fmt.Errorf("%w: lzo: data too short", errors.ErrDecompressionFailed)
+	}
+
+	totalLen := binary.LittleEndian.Uint32(src)
+	if totalLen > uint32(len(src)) || totalLen < lzoHeaderLen {
+		return nil, fmt.Errorf("%w: lzo: bad total length %d (have %d bytes)",
+			errors.ErrDecompressionFailed, totalLen, len(src))
+	}
+
+	out := make([]byte, 0, ramBytes)
+	segment := make([]byte, sectorSize)
+	pos := uint32(lzoHeaderLen)
+
+	for pos < totalLen && uint64(len(out)) < ramBytes {
+		if pos+lzoHeaderLen > totalLen {
+			return nil, fmt.Errorf("%w: lzo: truncated segment header at %d", errors.ErrDecompressionFailed, pos)
+		}
+		segLen := binary.LittleEndian.Uint32(src[pos:])
+		pos += lzoHeaderLen
+
+		if segLen > totalLen-pos {
+			return nil, fmt.Errorf("%w: lzo: segment at %d overruns extent", errors.ErrDecompressionFailed, pos)
+		}
+
+		n, err := lzo1xDecompress(src[pos:pos+segLen], segment)
+		if err != nil {
+			return nil, fmt.Errorf("%w: lzo: %v", errors.ErrDecompressionFailed, err)
+		}
+		out = append(out, segment[:n]...)
+		pos += segLen
+
+		// Skip the zero padding if the next header would cross a sector.
+		if left := sectorSize - pos%sectorSize; left < lzoHeaderLen {
+			pos += left
+		}
+	}
+
+	if uint64(len(out)) > ramBytes {
+		out = out[:ramBytes]
+	}
+	if uint64(len(out)) < ramBytes {
+		out = append(out, make([]byte, ramBytes-uint64(len(out)))...)
+	}
+	return out, nil
+}
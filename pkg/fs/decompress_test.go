@@ -0,0 +1,185 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex: %v", err)
+	}
+	return b
+}
+
+// padSector zero-pads data to a multiple of 4096 like an on-disk extent.
+func padSector(data []byte) []byte {
+	padded := make([]byte, (len(data)+4095)/4096*4096)
+	copy(padded, data)
+	return padded
+}
+
+func TestDecompressZlib(t *testing.T) {
+	plain := bytes.Repeat([]byte("btrfs zlib extent "), 1000)
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(plain)
+	w.Close()
+
+	got, err := decompress(ondisk.CompressZlib, padSector(buf.Bytes()), uint64(len(plain)), 4096)
+	if err != nil {
+		t.Fatalf("decompress failed: %v", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Error("zlib output mismatch")
+	}
+}
+
+func TestDecompressZstd(t *testing.T) {
+	plain := bytes.Repeat([]byte("btrfs zstd extent "), 1000)
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("zstd.NewWriter failed: %v", err)
+	}
+	compressed := enc.EncodeAll(plain, nil)
+	enc.Close()
+
+	got, err := decompress(ondisk.CompressZstd, padSector(compressed), uint64(len(plain)), 4096)
+	if err != nil {
+		t.Fatalf("decompress failed: %v", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Error("zstd output mismatch")
+	}
+}
+
+func TestDecompressLZOSegments(t *testing.T) {
+	tests := []struct {
+		name       string
+		plain      []byte
+		sectorSize uint32
+		data       string
+	}{
+		{
+			// Five literal-only segments with a 32-byte sector, so segment
+			// headers have to skip sector padding.
+			name:       "padded segments",
+			plain:      bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 3),
+			sectorSize: 32,
+			data: "b3000000240000003154686520717569636b2062726f776e20666f78206a756d7073206f76657220" +
+				"7411000024000000316865206c617a7920646f672e2054686520717569636b2062726f776e2066" +
+				"6f781100002400000031206a756d7073206f76657220746865206c617a7920646f672e20546865" +
+				"207175110000240000003169636b2062726f776e20666f78206a756d7073206f76657220746865" +
+				"206c617a1100000b000000187920646f672e20110000",
+		},
+		{
+			// Two segments built from long M3 matches.
+			name:       "matches",
+			plain:      bytes.Repeat([]byte("abcd"), 1000),
+			sectorSize: 4096,
+			data:       "2b0000002300000015616263642000000000000000b60c002000000000000000ae3c1f0161626364110000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decompress(ondisk.CompressLZO, mustHex(t, tt.data), uint64(len(tt.plain)), tt.sectorSize)
+			if err != nil {
+				t.Fatalf("decompress failed: %v", err)
+			}
+			if !bytes.Equal(got, tt.plain) {
+				t.Errorf("got %q, want %q", got, tt.plain)
+			}
+		})
+	}
+}
+
+func TestLZO1XInstructions(t *testing.T) {
+	// Initial literal "abcd", an M2 match with two trailing literals "xy",
+	// a 2-byte M1 match and the end-of-stream marker.
+	src := mustHex(t, "1561626364ee0078790400110000")
+	dst := make([]byte, 64)
+	n, err := lzo1xDecompress(src, dst)
+	if err != nil {
+		t.Fatalf("lzo1xDecompress failed: %v", err)
+	}
+	if got := string(dst[:n]); got != "abcdabcdabcdxyxy" {
+		t.Errorf("got %q, want %q", got, "abcdabcdabcdxyxy")
+	}
+}
+
+func TestLZO1XLongDistance(t *testing.T) {
+	// "abcd" extended to 20004 bytes by an M3 match, then a 9-byte M4
+	// match at distance 16389.
+	var src []byte
+	src = append(src, 0x15, 'a', 'b', 'c', 'd', 0x20)
+	src = append(src, make([]byte, 78)...)
+	src = append(src, 77, 0x0c, 0x00)
+	src = append(src, 0x17, 0x14, 0x00)
+	src = append(src, 0x11, 0x00, 0x00)
+
+	want := make([]byte, 0, 20013)
+	want = append(want, "abcd"...)
+	for len(want) < 20004 {
+		want = append(want, want[len(want)-4])
+	}
+	for len(want) < 20013 {
+		want = append(want, want[len(want)-16389])
+	}
+
+	dst := make([]byte, len(want))
+	n, err := lzo1xDecompress(src, dst)
+	if err != nil {
+		t.Fatalf("lzo1xDecompress failed: %v", err)
+	}
+	if !bytes.Equal(dst[:n], want) {
+		t.Error("M4 output mismatch")
+	}
+}
+
+func TestLZO1XCorruptInput(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	dst := make([]byte, 4096)
+
+	// Random input must never panic or write past dst.
+	for i := 0; i < 2000; i++ {
+		src := make([]byte, r.Intn(64)+1)
+		r.Read(src)
+		lzo1xDecompress(src, dst)
+	}
+
+	// A match reaching before the start of the output is rejected.
+	if _, err := lzo1xDecompress(mustHex(t, "1561626364ee08110000"), dst); err == nil {
+		t.Error("expected lookbehind error")
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	if _, err := decompress(ondisk.CompressLZ4, []byte{1, 2, 3}, 3, 4096); !errors.Is(err, errors.ErrUnsupportedCompression) {
+		t.Errorf("expected ErrUnsupportedCompression, got %v", err)
+	}
+
+	if _, err := decompress(ondisk.CompressZlib, []byte("not a zlib stream"), 100, 4096); !errors.Is(err, errors.ErrDecompressionFailed) {
+		t.Errorf("expected ErrDecompressionFailed for zlib, got %v", err)
+	}
+
+	if _, err := decompress(ondisk.CompressZstd, []byte("not a zstd stream"), 100, 4096); !errors.Is(err, errors.ErrDecompressionFailed) {
+		t.Errorf("expected ErrDecompressionFailed for zstd, got %v", err)
+	}
+
+	if _, err := decompress(ondisk.CompressLZO, []byte{0xff, 0, 0, 0}, 100, 4096); !errors.Is(err, errors.ErrDecompressionFailed) {
+		t.Errorf("expected ErrDecompressionFailed for lzo, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package fs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/WinBeyond/btrfs-read/pkg/device"
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/logger"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// openMembers opens the member devices of a filesystem and reads their
+// superblocks. Every member must carry the same FSID and a distinct device
+// ID. It returns the devices and superblocks by device ID, and the newest
+// superblock, which describes the filesystem.
+func openMembers(paths []string) (map[uint64]device.BlockDevice, map[uint64]*ondisk.Superblock, *ondisk.Superblock, error) {
+	if len(paths) == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: no device given", errors.ErrDeviceNotFound)
+	}
+
+	devices := make(map[uint64]device.BlockDevice)
+	superblocks := make(map[uint64]*ondisk.Superblock)
+	memberPaths := make(map[uint64]string)
+	var latest *ondisk.Superblock
+
+	fail := func(err error) (map[uint64]device.BlockDevice, map[uint64]*ondisk.Superblock, *ondisk.Superblock, error) {
+		closeDevices(devices)
+		return nil, nil, nil, err
+	}
+
+	for _, path := range paths {
+		dev, err := device.NewFileDevice(path)
+		if err != nil {
+			return fail(err)
+		}
+
+		sb, err := device.NewSuperblockReader(dev).ReadLatest()
+		if err != nil {
+			dev.Close()
+			return fail(fmt.Errorf("%s: %w", path, err))
+		}
+
+		devID := sb.DevItem.DevID
+		if latest != nil && sb.FSID != latest.FSID {
+			dev.Close()
+			return fail(fmt.Errorf("%s belongs to filesystem %s, not %s",
+				path, ondisk.UUID(sb.FSID), ondisk.UUID(latest.FSID)))
+		}
+		if other, ok := memberPaths[devID]; ok {
+			dev.Close()
+			return fail(fmt.Errorf("%s and %s are both device %d", other, path, devID))
+		}
+
+		dev.SetDeviceID(devID)
+		devices[devID] = dev
+		superblocks[devID] = sb
+		memberPaths[devID] = path
+		if latest == nil || sb.Generation > latest.Generation {
+			latest = sb
+		}
+	}
+
+	for devID, sb := range superblocks {
+		if sb.Generation != latest.Generation {
+			logger.Warn("Device %d (%s) is stale: generation %d, filesystem generation %d",
+				devID, memberPaths[devID], sb.Generation, latest.Generation)
+		}
+	}
+
+	return devices, superblocks, latest, nil
+}
+
+// closeDevices closes every device of a device table.
+func closeDevices(devices map[uint64]device.BlockDevice) {
+	for _, dev := range devices {
+		dev.Close()
+	}
+}
+
+// checkDevices matches the opened members against the DEV_ITEMs of the
+// chunk tree: a member must have the UUID recorded for its device ID.
+// Devices of the filesystem that were not given are recorded as missing.
+func (fs *FileSystem) checkDevices(superblocks map[uint64]*ondisk.Superblock) error {
+	known := make(map[uint64]bool)
+	for _, item := range fs.chunkManager.Devices() {
+		known[item.DevID] = true
+
+		sb, ok := superblocks[item.DevID]
+		if !ok {
+			fs.missingDevices = append(fs.missingDevices, item.DevID)
+			continue
+		}
+		if sb.DevItem.UUID != item.UUID {
+			return fmt.Errorf("device %d has UUID %s, but the chunk tree expects %s",
+				item.DevID, ondisk.UUID(sb.DevItem.UUID), ondisk.UUID(item.UUID))
+		}
+	}
+
+	for devID := range superblocks {
+		if !known[devID] {
+			logger.Warn("Device %d is not a member of the filesystem (removed or replaced), ignoring it", devID)
+			fs.devices[devID].Close()
+			delete(fs.devices, devID)
+		}
+	}
+
+	if len(fs.missingDevices) > 0 {
+		logger.Warn("%d of %d devices missing: %v", len(fs.missingDevices), fs.superblock.NumDevices, fs.missingDevices)
+	}
+
+	return nil
+}
+
+// NumDevices returns the number of devices the filesystem spans.
+func (fs *FileSystem) NumDevices() uint64 {
+	return fs.superblock.NumDevices
+}
+
+// MissingDevices returns the IDs of the devices of the filesystem that were
+// not opened, sorted. Data on them is read from mirrors or rebuilt from
+// parity where the RAID profile allows.
+func (fs *FileSystem) MissingDevices() []uint64 {
+	missing := append([]uint64(nil), fs.missingDevices...)
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	return missing
+}
@@ -0,0 +1,68 @@
+package fs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/chunk"
+	"github.com/WinBeyond/btrfs-read/pkg/device"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// nullDevice is an empty device that records whether it was closed.
+type nullDevice struct {
+	id     uint64
+	closed bool
+}
+
+func (d *nullDevice) ReadAt(p []byte, off int64) (int, error) { return len(p), nil }
+func (d *nullDevice) Size() int64                             { return 0 }
+func (d *nullDevice) DeviceID() uint64                        { return d.id }
+func (d *nullDevice) Close() error                            { d.closed = true; return nil }
+
+func TestCheckDevices(t *testing.T) {
+	member := func(id uint64, uuid byte) *ondisk.DevItem {
+		return &ondisk.DevItem{DevID: id, UUID: [16]byte{uuid}}
+	}
+	superblock := func(id uint64, uuid byte) *ondisk.Superblock {
+		return &ondisk.Superblock{DevItem: *member(id, uuid)}
+	}
+
+	newFS := func() *FileSystem {
+		m := chunk.NewManager()
+		for id := uint64(1); id <= 4; id++ {
+			m.AddDevice(member(id, byte(id)))
+		}
+		return &FileSystem{
+			superblock:   &ondisk.Superblock{NumDevices: 4},
+			chunkManager: m,
+			devices:      make(map[uint64]device.BlockDevice),
+		}
+	}
+
+	// Devices 1 and 3 given, plus device 7, which was removed from the
+	// filesystem.
+	fs := newFS()
+	stale := &nullDevice{id: 7}
+	fs.devices[1], fs.devices[3], fs.devices[7] = &nullDevice{id: 1}, &nullDevice{id: 3}, stale
+	err := fs.checkDevices(map[uint64]*ondisk.Superblock{
+		1: superblock(1, 1), 3: superblock(3, 3), 7: superblock(7, 7),
+	})
+	if err != nil {
+		t.Fatalf("checkDevices failed: %v", err)
+	}
+	if got := fs.MissingDevices(); !reflect.DeepEqual(got, []uint64{2, 4}) {
+		t.Errorf("MissingDevices = %v, want [2 4]", got)
+	}
+	if _, ok := fs.devices[7]; ok || !stale.closed {
+		t.Error("device 7 should have been closed and dropped")
+	}
+
+	// A member whose UUID differs from the chunk tree is a different device
+	// that reuses the ID, e.g. after a replace.
+	fs = newFS()
+	fs.devices[2] = &nullDevice{id: 2}
+	if err := fs.checkDevices(map[uint64]*ondisk.Superblock{2: superblock(2, 9)}); err == nil {
+		t.Error("UUID mismatch should fail")
+	}
+}
@@ -0,0 +1,230 @@
+package fs
+
+import (
+	"fmt"
+
+	"github.com/WinBeyond/btrfs-read/pkg/btree"
+	"github.com/WinBeyond/btrfs-read/pkg/chunk"
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/logger"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// DeviceStats are the persistent error counters the kernel keeps for each
+// device in the dev tree, as shown by btrfs device stats.
+type DeviceStats struct {
+	WriteErrs      uint64 `json:"write_io_errs"`
+	ReadErrs       uint64 `json:"read_io_errs"`
+	FlushErrs      uint64 `json:"flush_io_errs"`
+	CorruptionErrs uint64 `json:"corruption_errs"`
+	GenerationErrs uint64 `json:"generation_errs"`
+}
+
+// Total returns the sum of the counters.
+func (s DeviceStats) Total() uint64 {
+	return s.WriteErrs + s.ReadErrs + s.FlushErrs + s.CorruptionErrs + s.GenerationErrs
+}
+
+// DeviceInfo describes a member device of the filesystem.
+type DeviceInfo struct {
+	DevID      uint64      `json:"devid"`
+	UUID       ondisk.UUID `json:"uuid"`
+	TotalBytes uint64      `json:"total_bytes"` // Size of the device in the filesystem
+	BytesUsed  uint64      `json:"bytes_used"`  // Bytes allocated to chunks
+	Path       string      `json:"path"`        // Image the device was opened from
+	Missing    bool        `json:"missing"`     // Not given to Open
+	Stats      DeviceStats `json:"stats"`
+}
+
+// DevExtent is a range of a device allocated to one stripe of a chunk.
+type DevExtent struct {
+	DevID       uint64 `json:"devid"`
+	Physical    uint64 `json:"physical"`     // Start on the device
+	Length      uint64 `json:"length"`       // Length on the device
+	ChunkOffset uint64 `json:"chunk_offset"` // Logical address of the chunk
+}
+
+// Contains reports whether a physical offset of the device lies in the
+// extent.
+func (e *DevExtent) Contains(physical uint64) bool {
+	return physical >= e.Physical && physical < e.Physical+e.Length
+}
+
+// ListDevices returns every member device of the filesystem, sorted by
+// device ID: the DEV_ITEMs of the chunk tree, with the error counters of
+// the dev tree. Devices that were not opened are marked missing.
+func (fs *FileSystem) ListDevices() ([]*DeviceInfo, error) {
+	stats, err := fs.readDevStats()
+	if err != nil {
+		return nil, errors.Wrap("ListDevices", err)
+	}
+
+	var devices []*DeviceInfo
+	for _, item := range fs.chunkManager.Devices() {
+		info := &DeviceInfo{
+			DevID:      item.DevID,
+			UUID:       ondisk.UUID(item.UUID),
+			TotalBytes: item.TotalBytes,
+			BytesUsed:  item.BytesUsed,
+			Stats:      stats[item.DevID],
+		}
+		if dev, ok := fs.devices[item.DevID]; ok {
+			if p, ok := dev.(interface{ Path() string }); ok {
+				info.Path = p.Path()
+			}
+		} else {
+			info.Missing = true
+		}
+		devices = append(devices, info)
+	}
+
+	return devices, nil
+}
+
+// readDevStats reads the DEV_STATS items of the dev tree by device ID.
+// Devices without one never had an error recorded.
+func (fs *FileSystem) readDevStats() (map[uint64]DeviceStats, error) {
+	stats := make(map[uint64]DeviceStats)
+
+	root, err := fs.devTreeRoot()
+	if err != nil || root == 0 {
+		return stats, err
+	}
+
+	key := &btree.Key{ObjectID: ondisk.DevStatsObjectid, Type: ondisk.KeyTypePersistentItem}
+	err = fs.btreeSearcher.Walk(root, key, func(item *btree.Item) (bool, error) {
+		if item.Key.ObjectID != ondisk.DevStatsObjectid || item.Key.Type != ondisk.KeyTypePersistentItem {
+			return false, nil
+		}
+
+		var ds ondisk.DevStatsItem
+		if err := ds.Unmarshal(item.Data); err != nil {
+			logger.Warn("Failed to parse device stats of device %d: %v", item.Key.Offset, err)
+			return true, nil
+		}
+		stats[item.Key.Offset] = DeviceStats{
+			WriteErrs:      ds.Values[ondisk.DevStatWriteErrs],
+			ReadErrs:       ds.Values[ondisk.DevStatReadErrs],
+			FlushErrs:      ds.Values[ondisk.DevStatFlushErrs],
+			CorruptionErrs: ds.Values[ondisk.DevStatCorruptionErrs],
+			GenerationErrs: ds.Values[ondisk.DevStatGenerationErrs],
+		}
+		return true, nil
+	})
+
+	return stats, err
+}
+
+// DevExtents returns the DEV_EXTENTs of a device, sorted by physical
+// offset: the ranges of the device allocated to chunks.
+func (fs *FileSystem) DevExtents(devID uint64) ([]*DevExtent, error) {
+	root, err := fs.devTreeRoot()
+	if err != nil || root == 0 {
+		return nil, errors.Wrap("DevExtents", err)
+	}
+
+	var extents []*DevExtent
+	key := &btree.Key{ObjectID: devID, Type: ondisk.KeyTypeDevExtent}
+	err = fs.btreeSearcher.Walk(root, key, func(item *btree.Item) (bool, error) {
+		if item.Key.ObjectID != devID || item.Key.Type != ondisk.KeyTypeDevExtent {
+			return false, nil
+		}
+
+		extent, err := parseDevExtent(item)
+		if err != nil {
+			return false, err
+		}
+		extents = append(extents, extent)
+		return true, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap("DevExtents", err)
+	}
+
+	return extents, nil
+}
+
+// FindDevExtent maps a physical offset of a device back to the chunk that
+// owns it, by finding the DEV_EXTENT containing the offset. It fails with
+// ErrChunkNotFound when the offset is not allocated to any chunk, e.g. free
+// space or the area before the first chunk holding the superblock.
+func (fs *FileSystem) FindDevExtent(devID uint64, physical uint64) (*DevExtent, error) {
+	root, err := fs.devTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap("FindDevExtent", err)
+	}
+
+	// DEV_EXTENTs are keyed by their start: the candidate is the last item
+	// at or before (devid, DEV_EXTENT, physical).
+	key := &btree.Key{ObjectID: devID, Type: ondisk.KeyTypeDevExtent, Offset: physical}
+	var extent *DevExtent
+	if root != 0 {
+		c := fs.btreeSearcher.NewCursor(root)
+		ok, err := c.Seek(key)
+		if err == nil && (!ok || c.Item().Key.Compare(key) != 0) {
+			ok, err = c.Prev()
+		}
+		if err != nil {
+			return nil, errors.Wrap("FindDevExtent", err)
+		}
+		if ok && c.Item().Key.ObjectID == devID && c.Item().Key.Type == ondisk.KeyTypeDevExtent {
+			if extent, err = parseDevExtent(c.Item()); err != nil {
+				return nil, errors.Wrap("FindDevExtent", err)
+			}
+		}
+	}
+
+	if extent == nil || !extent.Contains(physical) {
+		return nil, fmt.Errorf("%w: device %d offset 0x%x is not allocated to a chunk",
+			errors.ErrChunkNotFound, devID, physical)
+	}
+	return extent, nil
+}
+
+// PhysicalToLogical maps an offset of a device, e.g. a bad sector reported
+// by the disk, back to the logical address stored there (see
+// chunk.Manager.PhysicalToLogical). The chunk is cross-checked against the
+// DEV_EXTENT covering the offset.
+func (fs *FileSystem) PhysicalToLogical(devID uint64, physical uint64) (*chunk.LogicalAddr, error) {
+	addr, err := fs.chunkManager.PhysicalToLogical(devID, physical)
+	if err != nil {
+		return nil, err
+	}
+
+	if extent, err := fs.FindDevExtent(devID, physical); err != nil {
+		logger.Warn("No dev extent for device %d offset 0x%x in chunk 0x%x: %v", devID, physical, addr.ChunkStart, err)
+	} else if extent.ChunkOffset != addr.ChunkStart {
+		logger.Warn("Dev extent of device %d offset 0x%x belongs to chunk 0x%x, the chunk tree says 0x%x",
+			devID, physical, extent.ChunkOffset, addr.ChunkStart)
+	}
+
+	return addr, nil
+}
+
+// devTreeRoot returns the root block of the dev tree, or 0 if the
+// filesystem has none.
+func (fs *FileSystem) devTreeRoot() (uint64, error) {
+	root, err := fs.readRootItem(ondisk.DevTreeObjectid)
+	if errors.Is(err, errors.ErrSubvolumeNotFound) {
+		logger.Debug("No dev tree: %v", err)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read dev tree root: %w", err)
+	}
+	return root.ByteNr, nil
+}
+
+// parseDevExtent decodes a DEV_EXTENT item.
+func parseDevExtent(item *btree.Item) (*DevExtent, error) {
+	var de ondisk.DevExtent
+	if err := de.Unmarshal(item.Data); err != nil {
+		return nil, fmt.Errorf("DEV_EXTENT of device %d at 0x%x: %w", item.Key.ObjectID, item.Key.Offset, err)
+	}
+	return &DevExtent{
+		DevID:       item.Key.ObjectID,
+		Physical:    item.Key.Offset,
+		Length:      de.Length,
+		ChunkOffset: de.ChunkOffset,
+	}, nil
+}
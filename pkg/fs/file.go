@@ -0,0 +1,289 @@
+package fs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	gopath "path"
+	"sync"
+
+	"github.com/WinBeyond/btrfs-read/pkg/btree"
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// File is an open regular file. Reads resolve only the EXTENT_DATA items
+// that overlap the requested range, so large files are never loaded whole.
+// ReadAt may be called from several goroutines at once; Read and Seek share
+// the file offset and, like on an *os.File, must not be.
+type File struct {
+	fs     *FileSystem
+	ino    uint64
+	size   uint64
+	info   *fileInfo
+	offset int64
+
+	// mu guards closed, the window buffer and the extent cache, which
+	// concurrent ReadAt calls share.
+	mu     sync.Mutex
+	closed bool
+
+	// buf holds an aligned window of file data so that small reads do not
+	// each walk the tree and hit the device.
+	buf    []byte
+	bufOff uint64
+
+	// cache holds the last decompressed extent so that neighbouring
+	// windows do not decompress the same extent over and over.
+	cache extentCache
+}
+
+// fileBufferSize is the window size used for reads smaller than a window.
+const fileBufferSize = 128 * 1024
+
+// extentCache remembers one decompressed extent by its disk address.
+type extentCache struct {
+	bytenr uint64
+	plain  []byte
+}
+
+// OpenFile opens a regular file for reading.
+func (fs *FileSystem) OpenFile(path string) (*File, error) {
+	sub, ino, err := fs.lookupPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	inodeInfo, err := sub.StatInode(ino)
+	if err != nil {
+		return nil, err
+	}
+
+	if inodeInfo.Mode&ondisk.ModeTypeMask == ondisk.ModeDir {
+		return nil, fmt.Errorf("%w: %s", errors.ErrNotRegularFile, path)
+	}
+
+	return &File{
+		fs:   sub,
+		ino:  ino,
+		size: inodeInfo.Size,
+		info: &fileInfo{name: gopath.Base(path), inode: inodeInfo},
+	}, nil
+}
+
+// Size returns the file size in bytes.
+func (f *File) Size() int64 {
+	return int64(f.size)
+}
+
+// Stat returns the file's metadata. Sys returns the *InodeInfo.
+func (f *File) Stat() (iofs.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, os.ErrClosed
+	}
+	return f.info, nil
+}
+
+// Read implements io.Reader.
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if uint64(off) >= f.size {
+		return 0, io.EOF
+	}
+
+	n := len(p)
+	if remaining := f.size - uint64(off); uint64(n) > remaining {
+		n = int(remaining)
+	}
+
+	if n < fileBufferSize {
+		if err := f.readBuffered(p[:n], uint64(off)); err != nil {
+			return 0, err
+		}
+	} else {
+		// Bytes not covered by any extent are holes and read as zeros.
+		clear(p[:n])
+		if err := f.fs.readRange(f.ino, uint64(off), p[:n], &f.cache); err != nil {
+			return 0, err
+		}
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readBuffered serves a small read from the window buffer, loading the
+// aligned windows that cover [off, off+len(p)) as needed. f.mu must be held.
+func (f *File) readBuffered(p []byte, off uint64) error {
+	for len(p) > 0 {
+		if f.buf == nil || off < f.bufOff || off >= f.bufOff+uint64(len(f.buf)) {
+			start := off - off%fileBufferSize
+			size := f.size - start
+			if size > fileBufferSize {
+				size = fileBufferSize
+			}
+
+			if cap(f.buf) < fileBufferSize {
+				f.buf = make([]byte, fileBufferSize)
+			}
+			buf := f.buf[:size]
+			clear(buf)
+			if err := f.fs.readRange(f.ino, start, buf, &f.cache); err != nil {
+				f.buf = nil
+				return err
+			}
+			f.buf, f.bufOff = buf, start
+		}
+
+		n := copy(p, f.buf[off-f.bufOff:])
+		p = p[n:]
+		off += uint64(n)
+	}
+	return nil
+}
+
+// Seek implements io.Seeker.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	if closed {
+		return 0, os.ErrClosed
+	}
+
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.offset + offset
+	case io.SeekEnd:
+		abs = int64(f.size) + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position %d", abs)
+	}
+	f.offset = abs
+	return abs, nil
+}
+
+// Close implements io.Closer. The underlying filesystem stays open.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	f.buf = nil
+	f.cache = extentCache{}
+	return nil
+}
+
+// readRange fills dst with file data starting at file offset off. dst must
+// be zeroed by the caller; extents that do not overlap the range are skipped
+// without reading their data.
+func (fs *FileSystem) readRange(ino uint64, off uint64, dst []byte, cache *extentCache) error {
+	end := off + uint64(len(dst))
+
+	key := &btree.Key{
+		ObjectID: ino,
+		Type:     ondisk.KeyTypeExtentData,
+		Offset:   off,
+	}
+
+	// The extent covering off is the last EXTENT_DATA item at or before it,
+	// so step back one item unless the seek landed exactly on off.
+	c := fs.btreeSearcher.NewCursor(fs.fsTreeRoot)
+	ok, err := c.Seek(key)
+	if err != nil {
+		return err
+	}
+	if !ok || c.Item().Key.Compare(key) != 0 {
+		if ok, err = c.Prev(); err != nil {
+			return err
+		}
+		if !ok || c.Item().Key.ObjectID != ino || c.Item().Key.Type != ondisk.KeyTypeExtentData {
+			if ok, err = c.Next(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for ; ok; ok, err = c.Next() {
+		item := c.Item()
+		if item.Key.ObjectID != ino || item.Key.Type != ondisk.KeyTypeExtentData {
+			return nil
+		}
+
+		extentStart := item.Key.Offset
+		if extentStart >= end {
+			return nil
+		}
+
+		extentLen, err := extentLength(item.Data)
+		if err != nil {
+			return fmt.Errorf("inode %d extent at offset %d: %w", ino, extentStart, err)
+		}
+		if extentStart+extentLen <= off {
+			continue
+		}
+
+		var skip uint64
+		var target []byte
+		if extentStart < off {
+			skip = off - extentStart
+			target = dst
+		} else {
+			target = dst[extentStart-off:]
+		}
+
+		if err := fs.readExtentData(item.Data, skip, target, cache); err != nil {
+			return fmt.Errorf("inode %d extent at offset %d: %w", ino, extentStart, err)
+		}
+	}
+	return err
+}
+
+// extentLength returns the number of file bytes an EXTENT_DATA item covers.
+func extentLength(data []byte) (uint64, error) {
+	if len(data) < 21 {
+		return 0, fmt.Errorf("EXTENT_DATA too short")
+	}
+
+	if data[20] == ondisk.FileExtentInline {
+		// ram_bytes is the decoded size of the inline data.
+		return binary.LittleEndian.Uint64(data[8:16]), nil
+	}
+
+	if len(data) < 53 {
+		return 0, fmt.Errorf("REGULAR extent data too short")
+	}
+	return binary.LittleEndian.Uint64(data[45:53]), nil
+}
@@ -1,9 +1,12 @@
 package fs
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"hash/crc32"
+	"math"
+	"sort"
 	"strings"
 
 	"github.com/WinBeyond/btrfs-read/pkg/btree"
@@ -20,218 +23,367 @@ var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
 // FileSystem represents a Btrfs filesystem.
 type FileSystem struct {
 	superblock   *ondisk.Superblock
-	device       *device.FileDevice
 	chunkManager *chunk.Manager
 	cache        *device.BlockCache
 
+	// devices maps device IDs to the opened member devices;
+	// missingDevices lists the members of the filesystem that were not
+	// given.
+	devices        map[uint64]device.BlockDevice
+	missingDevices []uint64
+
 	fsTreeRoot    uint64
+	subvolID      uint64
 	btreeSearcher *btree.Searcher
+
+	// verify enables checksum, bytenr and FSID checks of tree blocks.
+	verify bool
+
+	// csumRoot is the root of the csum tree, or 0 if data checksums are
+	// not available.
+	csumRoot uint64
+
+	// backupRoot is the superblock backup root slot the trees were loaded
+	// from, or -1 for the current roots.
+	backupRoot int
+
+	// view is set on filesystems returned by OpenSubvolume, which share
+	// the device of the filesystem they were opened from.
+	view bool
+}
+
+// OpenOptions controls how a filesystem is opened. The zero value gives
+// the defaults used by Open.
+type OpenOptions struct {
+	// SkipChecksums disables verification of tree blocks and file data. By
+	// default every tree block is checked against its checksum, and its
+	// header bytenr and FSID must match the address it was read for and the
+	// filesystem, and file data is checked against the csum tree, so that a
+	// corrupted copy is detected and another one read instead.
+	SkipChecksums bool
+
+	// UseBackupRoot lets Open fall back to the superblock backup root sets
+	// when the current root or chunk tree cannot be read or verified, like
+	// the kernel's usebackuproot mount option. It is the number of sets to
+	// try at most, newest first, not a slot number: BackupRoot reports the
+	// slot that was used. 0 disables the fallback; ondisk.NumBackupRoots
+	// tries them all.
+	UseBackupRoot int
 }
 
-// Open opens a filesystem.
+// Open opens a filesystem with the default options.
 func Open(devicePath string) (*FileSystem, error) {
-	// 1. Open device.
-	dev, err := device.NewFileDevice(devicePath)
+	return OpenWithOptions(devicePath, OpenOptions{})
+}
+
+// OpenWithOptions opens a filesystem.
+func OpenWithOptions(devicePath string, opts OpenOptions) (*FileSystem, error) {
+	return OpenDevicesWithOptions([]string{devicePath}, opts)
+}
+
+// OpenDevices opens a filesystem that spans several devices, given one image
+// or block device per member in any order, with the default options.
+func OpenDevices(paths ...string) (*FileSystem, error) {
+	return OpenDevicesWithOptions(paths, OpenOptions{})
+}
+
+// OpenDevicesWithOptions opens a filesystem from its member devices. The
+// members must share an FSID and are matched to the chunk tree by device ID
+// and UUID. Members that are not given are reported by MissingDevices;
+// their data is read from mirrors or parity where the RAID profile allows.
+func OpenDevicesWithOptions(paths []string, opts OpenOptions) (*FileSystem, error) {
+	// 1. Open the devices and read their superblocks.
+	devices, superblocks, sb, err := openMembers(paths)
 	if err != nil {
 		return nil, errors.Wrap("FileSystem.Open", err)
 	}
+	if !opts.SkipChecksums && ondisk.CsumSize(sb.CsumType) == 0 {
+		closeDevices(devices)
+		return nil, errors.Wrap("FileSystem.Open", fmt.Errorf("unsupported checksum type %d", sb.CsumType))
+	}
 
-	// 2. Read superblock.
-	sbReader := device.NewSuperblockReader(dev)
-	sb, err := sbReader.ReadLatest()
+	// 2. Load the trees from the current roots, then from the backup roots.
+	fs, err := openRoots(devices, sb, opts)
+	if err != nil {
+		fs, err = openBackupRoots(devices, sb, opts, err)
+	}
 	if err != nil {
-		dev.Close()
-		return nil, errors.Wrap("FileSystem.Open.ReadSuperblock", err)
+		closeDevices(devices)
+		return nil, err
+	}
+
+	// 3. Match the members against the device list of the chunk tree.
+	if err := fs.checkDevices(superblocks); err != nil {
+		closeDevices(devices)
+		return nil, errors.Wrap("FileSystem.Open.CheckDevices", err)
+	}
+
+	return fs, nil
+}
+
+// openBackupRoots retries openRoots with the superblock backup roots allowed
+// by opts, after the current roots failed with err.
+func openBackupRoots(devices map[uint64]device.BlockDevice, sb *ondisk.Superblock, opts OpenOptions, err error) (*FileSystem, error) {
+	for _, slot := range backupRootSlots(sb, opts.UseBackupRoot) {
+		backup := &sb.SuperRoots[slot]
+		logger.Warn("Current tree roots unusable (%v), trying backup root %d (generation %d)", err, slot, backup.TreeRootGen)
+
+		// Open from a copy of the superblock pointing at the backup roots,
+		// so the rest of the filesystem does not need to know.
+		old := *sb
+		old.Root, old.RootLevel = backup.TreeRoot, backup.TreeRootLevel
+		old.ChunkRoot, old.ChunkRootLevel = backup.ChunkRoot, backup.ChunkRootLevel
+
+		fs, backupErr := openRoots(devices, &old, opts)
+		if backupErr != nil {
+			logger.Warn("Backup root %d unusable: %v", slot, backupErr)
+			continue
+		}
+		fs.backupRoot = slot
+		logger.Info("Opened with backup root %d (generation %d)", slot, backup.TreeRootGen)
+		return fs, nil
 	}
 
-	// 3. Initialize chunk manager.
+	return nil, err
+}
+
+// openRoots loads the chunk tree and the default subvolume from the tree
+// roots recorded in sb.
+func openRoots(devices map[uint64]device.BlockDevice, sb *ondisk.Superblock, opts OpenOptions) (*FileSystem, error) {
+	// 1. Initialize chunk manager.
 	chunkMgr := chunk.NewManager()
 
 	// Initialize from the system chunk array (bootstrap chunks).
 	if err := chunkMgr.ParseSystemChunkArray(sb.SysChunkArray[:], sb.SysChunkArraySize); err != nil {
-		dev.Close()
 		return nil, errors.Wrap("FileSystem.Open.ParseChunks", err)
 	}
 
-	// 4. Create cache.
+	// 2. Create cache. Each attempt gets its own, since a logical address
+	// may hold a different block in another generation.
 	cache := device.NewBlockCache(256)
 
-	// 5. Create filesystem instance (temporary, for loading the chunk tree).
+	// 3. Create filesystem instance (temporary, for loading the chunk tree).
 	fs := &FileSystem{
 		superblock:   sb,
-		device:       dev,
+		devices:      devices,
 		chunkManager: chunkMgr,
 		cache:        cache,
 		fsTreeRoot:   sb.Root,
+		verify:       !opts.SkipChecksums,
+		backupRoot:   -1,
 	}
 
-	// 6. Create B-Tree searcher.
+	// 4. Create B-Tree searcher.
 	fs.btreeSearcher = btree.NewSearcher(fs, sb.NodeSize)
 
-	// 7. Load all chunks from the chunk tree.
+	// 5. Load all chunks from the chunk tree.
 	loader := chunk.NewChunkTreeLoader(chunkMgr, fs, sb.NodeSize)
 	if err := loader.LoadFromChunkTree(sb.ChunkRoot); err != nil {
-		dev.Close()
 		return nil, errors.Wrap("FileSystem.Open.LoadChunkTree", err)
 	}
 
-	// 8. Find the FS_TREE root from the Root Tree.
-	fsTreeRoot, err := fs.findFSTreeRoot()
+	// 6. Find the FS tree of the default subvolume from the Root Tree.
+	subvolID, err := fs.defaultSubvolumeID()
+	if err != nil {
+		return nil, errors.Wrap("FileSystem.Open.DefaultSubvolume", err)
+	}
+
+	root, err := fs.readRootItem(subvolID)
 	if err != nil {
-		dev.Close()
 		return nil, errors.Wrap("FileSystem.Open.FindFSTree", err)
 	}
-	fs.fsTreeRoot = fsTreeRoot
+	fs.fsTreeRoot = root.ByteNr
+	fs.subvolID = subvolID
 
-	logger.Debug("FS Tree root: 0x%x", fsTreeRoot)
+	logger.Debug("FS Tree root: 0x%x (subvolume %d)", fs.fsTreeRoot, subvolID)
+
+	// 7. Find the csum tree. Without it data is read unverified.
+	if csumRoot, err := fs.readRootItem(ondisk.CsumTreeObjectid); err == nil {
+		fs.csumRoot = csumRoot.ByteNr
+	} else {
+		logger.Debug("No csum tree, data checksums disabled: %v", err)
+	}
 
 	return fs, nil
 }
 
-// findFSTreeRoot finds the FS_TREE root node address from the Root Tree.
-func (fs *FileSystem) findFSTreeRoot() (uint64, error) {
-	// Search ROOT_ITEM: objectid=5 (FS_TREE), type=132 (ROOT_ITEM_KEY).
-	key := &btree.Key{
-		ObjectID: 5,   // BTRFS_FS_TREE_OBJECTID
-		Type:     132, // BTRFS_ROOT_ITEM_KEY
-		Offset:   0,
+// backupRootSlots returns up to limit backup root slots to fall back to,
+// newest generation first. Empty slots and the slot holding the current
+// roots, which the kernel also records as a backup, are skipped.
+func backupRootSlots(sb *ondisk.Superblock, limit int) []int {
+	if limit <= 0 {
+		return nil
 	}
 
-	path, err := fs.btreeSearcher.Search(fs.superblock.Root, key)
-	if err != nil {
-		return 0, fmt.Errorf("search failed: %w", err)
+	var slots []int
+	for i := range sb.SuperRoots {
+		backup := &sb.SuperRoots[i]
+		if backup.IsEmpty() || (backup.TreeRoot == sb.Root && backup.ChunkRoot == sb.ChunkRoot) {
+			continue
+		}
+		slots = append(slots, i)
 	}
 
-	item, err := path.GetItem()
-	if err != nil {
-		return 0, fmt.Errorf("get item failed: %w", err)
+	sort.SliceStable(slots, func(i, j int) bool {
+		return sb.SuperRoots[slots[i]].TreeRootGen > sb.SuperRoots[slots[j]].TreeRootGen
+	})
+	if len(slots) > limit {
+		slots = slots[:limit]
 	}
+	return slots
+}
 
-	// Check whether the FS_TREE ROOT_ITEM was found.
-	if item.Key.ObjectID != 5 || item.Key.Type != 132 {
-		return 0, fmt.Errorf("FS_TREE ROOT_ITEM not found, got key: objectid=%d type=%d",
-			item.Key.ObjectID, item.Key.Type)
-	}
+// BackupRoot returns the superblock backup root slot the filesystem was
+// opened with, or -1 if the current roots were used.
+func (fs *FileSystem) BackupRoot() int {
+	return fs.backupRoot
+}
 
-	// Parse ROOT_ITEM and extract bytenr (root node address).
-	// ROOT_ITEM format (simplified):
-	// ...
-	// offset 176: bytenr (8 bytes)
-	if len(item.Data) < 184 {
-		return 0, fmt.Errorf("ROOT_ITEM data too short: %d bytes", len(item.Data))
+// readRootItem reads the ROOT_ITEM of a tree from the Root Tree. Snapshots
+// key their ROOT_ITEM by creation transid, so any offset is accepted.
+func (fs *FileSystem) readRootItem(treeID uint64) (*ondisk.RootItem, error) {
+	key := &btree.Key{
+		ObjectID: treeID,
+		Type:     ondisk.KeyTypeRootItem,
+		Offset:   0,
 	}
 
-	bytenr := binary.LittleEndian.Uint64(item.Data[176:184])
+	var root *ondisk.RootItem
+	err := fs.btreeSearcher.Walk(fs.superblock.Root, key, func(item *btree.Item) (bool, error) {
+		if item.Key.ObjectID != treeID || item.Key.Type != ondisk.KeyTypeRootItem {
+			return false, nil
+		}
 
-	return bytenr, nil
+		root = &ondisk.RootItem{}
+		if err := root.Unmarshal(item.Data); err != nil {
+			return false, fmt.Errorf("ROOT_ITEM %d: %w", treeID, err)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%w: ROOT_ITEM %d", errors.ErrSubvolumeNotFound, treeID)
+	}
+	return root, nil
 }
 
-// Close closes the filesystem.
+// Close closes the filesystem. Closing a filesystem returned by
+// OpenSubvolume does nothing; close the filesystem it was opened from.
 func (fs *FileSystem) Close() error {
-	if fs.device != nil {
-		return fs.device.Close()
+	if fs.view {
+		return nil
 	}
-	return nil
+
+	var firstErr error
+	for _, dev := range fs.devices {
+		if err := dev.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // ReadNode implements btree.NodeReader.
 func (fs *FileSystem) ReadNode(logical uint64, nodeSize uint32) (*btree.Node, error) {
-	// 1. Logical address -> physical address.
-	physAddr, err := fs.chunkManager.LogicalToPhysical(logical)
-	if err != nil {
-		return nil, errors.Wrap("ReadNode.LogicalToPhysical", err)
-	}
-
-	// 2. Check cache.
+	// 1. Check cache.
 	cacheKey := logical
 	if cached, ok := fs.cache.Get(cacheKey); ok {
 		return btree.UnmarshalNode(cached, nodeSize)
 	}
 
-	// 3. Read from device.
+	// 2. Read from device. The block is verified before caching it, so
+	// cached blocks are known to be good; a copy that cannot be read or
+	// fails verification is retried from the next mirror.
 	buf := make([]byte, nodeSize)
-	n, err := fs.device.ReadAt(buf, int64(physAddr.Offset))
-	if err != nil || n != int(nodeSize) {
-		return nil, fmt.Errorf("failed to read node: %w", err)
+	err := fs.readMirrors("tree block", logical, buf, func(buf []byte) error {
+		if fs.verify {
+			return fs.verifyNode(logical, buf)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// 4. Put into cache.
+	// 3. Put into cache.
 	fs.cache.Put(cacheKey, buf)
 
-	// 5. Parse node.
+	// 4. Parse node.
 	return btree.UnmarshalNode(buf, nodeSize)
 }
 
+// verifyNode checks that a tree block read for a logical address is intact
+// and is the block that was asked for: its checksum matches, its header
+// bytenr is the address and its FSID belongs to this filesystem.
+func (fs *FileSystem) verifyNode(logical uint64, buf []byte) error {
+	if err := ondisk.VerifyChecksum(fs.superblock.CsumType, buf); err != nil {
+		return fmt.Errorf("%w: tree block 0x%x: %v", errors.ErrInvalidChecksum, logical, err)
+	}
+
+	// Header: csum (32) + fsid (16) + bytenr (8) + ...
+	if bytenr := binary.LittleEndian.Uint64(buf[48:56]); bytenr != logical {
+		return fmt.Errorf("%w: tree block 0x%x: header bytenr is 0x%x", errors.ErrInvalidChecksum, logical, bytenr)
+	}
+	fsid := fs.superblock.MetadataFSID()
+	if !bytes.Equal(buf[32:48], fsid[:]) {
+		return fmt.Errorf("%w: tree block 0x%x: fsid %x does not match the filesystem", errors.ErrInvalidChecksum, logical, buf[32:48])
+	}
+
+	return nil
+}
+
 // DirEntry represents a directory entry.
 type DirEntry struct {
 	Name  string `json:"name"`
 	Inode uint64 `json:"inode"`
 	Type  uint8  `json:"type"`
 	IsDir bool   `json:"is_dir"`
+
+	// Subvolume is the ID of the subvolume the entry links, or 0 for an
+	// ordinary entry. Inode is then the subvolume's root directory.
+	Subvolume uint64 `json:"subvolume,omitempty"`
 }
 
 // ListDirectory lists directory contents.
 func (fs *FileSystem) ListDirectory(path string) ([]*DirEntry, error) {
 	// 1. Resolve path and get directory inode.
-	var dirIno uint64
-	if path == "/" || path == "" {
-		dirIno = 256 // Root directory.
-	} else {
-		ino, err := fs.lookupPath(path)
+	sub, dirIno := fs, uint64(256) // Root directory.
+	if path != "/" && path != "" {
+		var err error
+		sub, dirIno, err = fs.lookupPath(path)
 		if err != nil {
 			return nil, err
 		}
-		dirIno = ino
 	}
 
 	// 2. Iterate directory entries.
-	// Search all DIR_INDEX or DIR_ITEM.
-	// Simplified: only search DIR_INDEX (type=96).
-	entries := make([]*DirEntry, 0)
-	seenOffsets := make(map[uint64]bool)
-
-	// Iterate using DIR_INDEX (faster).
-	// DIR_INDEX key: objectid=dir_ino, type=96, offset=index.
-	for index := uint64(0); index < 10000; index++ {
-		key := &btree.Key{
-			ObjectID: dirIno,
-			Type:     96, // DIR_INDEX
-			Offset:   index,
-		}
-
-		path, err := fs.btreeSearcher.Search(fs.fsTreeRoot, key)
-		if err != nil {
-			break
-		}
-
-		item, err := path.GetItem()
-		if err != nil {
-			break
-		}
-
-		// Check whether it is still the same directory's DIR_INDEX.
-		if item.Key.ObjectID != dirIno || item.Key.Type != 96 {
-			break
-		}
+	return sub.listDirectory(dirIno)
+}
 
-		// Deduplicate: skip offsets already seen.
-		if seenOffsets[item.Key.Offset] {
-			continue
-		}
-		seenOffsets[item.Key.Offset] = true
+// listDirectory lists the entries of a directory inode in index order.
+// It walks the (dirIno, DIR_INDEX, *) key range once, leaf by leaf, so the
+// cost is proportional to the number of entries and the index numbers may
+// be arbitrarily sparse.
+func (fs *FileSystem) listDirectory(dirIno uint64) ([]*DirEntry, error) {
+	entries := make([]*DirEntry, 0)
 
-		// If the found offset is greater than current index, jump to it.
-		if item.Key.Offset > index {
-			index = item.Key.Offset
-		}
+	minKey := &btree.Key{ObjectID: dirIno, Type: ondisk.KeyTypeDirIndex, Offset: 0}
+	maxKey := &btree.Key{ObjectID: dirIno, Type: ondisk.KeyTypeDirIndex, Offset: math.MaxUint64}
 
-		// Parse DIR_INDEX.
+	err := fs.btreeSearcher.ScanRange(fs.fsTreeRoot, minKey, maxKey, func(item *btree.Item) (bool, error) {
 		entry, err := fs.parseDirIndex(item.Data)
 		if err != nil {
-			continue
+			logger.Warn("Skipping DIR_INDEX %d of inode %d: %v", item.Key.Offset, dirIno, err)
+			return true, nil
 		}
 
 		entries = append(entries, entry)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return entries, nil
@@ -246,8 +398,13 @@ func (fs *FileSystem) parseDirIndex(data []byte) (*DirEntry, error) {
 	// DIR_INDEX/DIR_ITEM format:
 	// location (key: 17 bytes) + transid (8) + data_len (2) + name_len (2) + type (1) + name
 
-	// location.objectid (target inode).
+	// location.objectid (target inode, or subvolume ID if location.type
+	// is ROOT_ITEM).
 	targetIno := binary.LittleEndian.Uint64(data[0:8])
+	var subvol uint64
+	if data[8] == ondisk.KeyTypeRootItem {
+		subvol, targetIno = targetIno, ondisk.FirstFreeObjectid
+	}
 
 	// name_len.
 	nameLen := binary.LittleEndian.Uint16(data[27:29])
@@ -266,19 +423,63 @@ func (fs *FileSystem) parseDirIndex(data []byte) (*DirEntry, error) {
 		Inode: targetIno,
 		Type:  fileType,
 		IsDir: fileType == 2, // BTRFS_FT_DIR = 2
+
+		Subvolume: subvol,
 	}, nil
 }
 
+// dirItem is one entry of a DIR_ITEM or XATTR_ITEM. Entries whose names
+// share a hash are packed into the same item.
+type dirItem struct {
+	location btree.Key
+	fileType uint8
+	name     []byte
+	data     []byte
+}
+
+// parseDirItems splits a DIR_ITEM or XATTR_ITEM into its packed entries.
+func parseDirItems(data []byte) ([]dirItem, error) {
+	var items []dirItem
+
+	// Each entry: location (key: 17 bytes) + transid (8) + data_len (2) +
+	// name_len (2) + type (1) + name + data.
+	for len(data) > 0 {
+		if len(data) < 30 {
+			return nil, fmt.Errorf("dir item header truncated")
+		}
+
+		dataLen := int(binary.LittleEndian.Uint16(data[25:27]))
+		nameLen := int(binary.LittleEndian.Uint16(data[27:29]))
+		if len(data) < 30+nameLen+dataLen {
+			return nil, fmt.Errorf("dir item name/data out of bounds")
+		}
+
+		items = append(items, dirItem{
+			location: btree.Key{
+				ObjectID: binary.LittleEndian.Uint64(data[0:8]),
+				Type:     data[8],
+				Offset:   binary.LittleEndian.Uint64(data[9:17]),
+			},
+			fileType: data[29],
+			name:     data[30 : 30+nameLen],
+			data:     data[30+nameLen : 30+nameLen+dataLen],
+		})
+		data = data[30+nameLen+dataLen:]
+	}
+
+	return items, nil
+}
+
 // ReadFile reads file contents.
 func (fs *FileSystem) ReadFile(path string) ([]byte, error) {
 	// 1. Resolve path and get inode.
-	ino, err := fs.lookupPath(path)
+	sub, ino, err := fs.lookupPath(path)
 	if err != nil {
 		return nil, err
 	}
 
 	// 2. Read inode info.
-	inodeInfo, err := fs.readInode(ino)
+	inodeInfo, err := sub.StatInode(ino)
 	if err != nil {
 		return nil, err
 	}
@@ -288,57 +489,123 @@ func (fs *FileSystem) ReadFile(path string) ([]byte, error) {
 	}
 
 	// 3. Read file data.
-	return fs.readFileData(ino, inodeInfo.Size)
+	return sub.readFileData(ino, inodeInfo.Size)
 }
 
-// lookupPath resolves a path (simplified: assumes /filename).
-func (fs *FileSystem) lookupPath(path string) (uint64, error) {
-	// Support multi-level traversal.
-	// Path format: /dir1/dir2/filename.
+// maxSymlinkFollows limits symlink expansion during path resolution, like
+// MAXSYMLINKS in Linux.
+const maxSymlinkFollows = 40
 
-	if !strings.HasPrefix(path, "/") {
-		return 0, fmt.Errorf("path must start with /")
-	}
+// lookupPath resolves an absolute path to an inode, following symlinks in
+// every component including the last one. It returns the filesystem of the
+// subvolume that holds the inode, which differs from fs when the path
+// crosses into a nested subvolume.
+func (fs *FileSystem) lookupPath(path string) (*FileSystem, uint64, error) {
+	return fs.resolvePath(path, true)
+}
 
-	path = strings.TrimPrefix(path, "/")
+// pathDir is a directory on the chain walked by resolvePath.
+type pathDir struct {
+	fs  *FileSystem // Subvolume holding the directory
+	ino uint64
+}
 
-	if path == "" {
-		// Root directory.
-		return 256, nil // BTRFS_FIRST_FREE_OBJECTID
+// resolvePath resolves an absolute path to an inode.
+// Symlinks in intermediate components are always followed; followLast
+// decides whether a symlink in the final component is followed too.
+// Relative targets are resolved from the directory holding the link and
+// absolute targets from the image root. "." and ".." are handled while
+// walking, and ".." at the root stays at the root. Entries that link a
+// nested subvolume switch to that subvolume's tree, and ".." from its root
+// directory switches back.
+func (fs *FileSystem) resolvePath(path string, followLast bool) (*FileSystem, uint64, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, 0, fmt.Errorf("path must start with /")
 	}
 
-	// Split the path.
+	// dirs is the chain of directories from the root to the current one.
+	dirs := []pathDir{{fs: fs, ino: ondisk.FirstFreeObjectid}}
 	parts := strings.Split(path, "/")
+	follows := 0
 
-	// Start from the root directory.
-	currentIno := uint64(256)
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
 
-	for i, part := range parts {
-		if part == "" {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(dirs) > 1 {
+				dirs = dirs[:len(dirs)-1]
+			}
 			continue
 		}
 
 		// Look for the next component in the current directory.
-		ino, err := fs.lookupDirItem(currentIno, part)
+		dir := dirs[len(dirs)-1]
+		location, fileType, err := dir.fs.lookupDirItem(dir.ino, part)
 		if err != nil {
-			return 0, fmt.Errorf("file not found: %s", path)
+			return nil, 0, fmt.Errorf("file not found: %s: %w", strings.TrimPrefix(path, "/"), err)
 		}
 
-		// If not the last component, check that it is a directory.
-		if i < len(parts)-1 {
-			// Should be a directory, continue to the next level.
-			currentIno = ino
-		} else {
-			// Last component; return its inode.
-			return ino, nil
+		next := pathDir{fs: dir.fs, ino: location.ObjectID}
+		if location.Type == ondisk.KeyTypeRootItem {
+			sub, err := dir.fs.OpenSubvolume(location.ObjectID)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s: %w", part, err)
+			}
+			next = pathDir{fs: sub, ino: ondisk.FirstFreeObjectid}
 		}
+
+		last := isLastComponent(parts)
+
+		if fileType == ondisk.FtSymlink && (!last || followLast) {
+			follows++
+			if follows > maxSymlinkFollows {
+				return nil, 0, fmt.Errorf("%w: %s", errors.ErrSymlinkLoop, path)
+			}
+
+			target, err := next.fs.readlinkInode(next.ino)
+			if err != nil {
+				return nil, 0, err
+			}
+			if strings.HasPrefix(target, "/") {
+				dirs = dirs[:1]
+			}
+			parts = append(strings.Split(target, "/"), parts...)
+			continue
+		}
+
+		if last {
+			return next.fs, next.ino, nil
+		}
+
+		// Not the last component, so it must be a directory.
+		if fileType != ondisk.FtDir {
+			return nil, 0, fmt.Errorf("%w: %s", errors.ErrNotDirectory, part)
+		}
+		dirs = append(dirs, next)
 	}
 
-	return currentIno, nil
+	dir := dirs[len(dirs)-1]
+	return dir.fs, dir.ino, nil
+}
+
+// isLastComponent reports whether no named components remain.
+func isLastComponent(parts []string) bool {
+	for _, part := range parts {
+		if part != "" && part != "." {
+			return false
+		}
+	}
+	return true
 }
 
-// lookupDirItem finds an entry in a directory.
-func (fs *FileSystem) lookupDirItem(dirIno uint64, name string) (uint64, error) {
+// lookupDirItem finds an entry in a directory and returns its location and
+// BTRFS_FT_* type. The location is an INODE_ITEM key for entries in the same
+// subvolume and a ROOT_ITEM key for a nested subvolume.
+func (fs *FileSystem) lookupDirItem(dirIno uint64, name string) (*btree.Key, uint8, error) {
 	// Compute the name hash.
 	nameHash := crc32Hash([]byte(name))
 
@@ -352,43 +619,57 @@ func (fs *FileSystem) lookupDirItem(dirIno uint64, name string) (uint64, error)
 	path, err := fs.btreeSearcher.Search(fs.fsTreeRoot, key)
 	if err != nil {
 		logger.Debug("DIR_ITEM search failed: %v", err)
-		return 0, err
+		return nil, 0, err
 	}
 
 	item, err := path.GetItem()
 	if err != nil {
+		// The key sorts after the last item of the leaf.
 		logger.Debug("Failed to get DIR_ITEM: %v", err)
-		return 0, err
+		return nil, 0, fmt.Errorf("%w: %s", errors.ErrPathNotFound, name)
 	}
 
 	// Check for an exact match.
 	if item.Key.Compare(key) != 0 {
-		return 0, fmt.Errorf("file not found: %s", name)
+		return nil, 0, fmt.Errorf("%w: %s", errors.ErrPathNotFound, name)
 	}
 
-	// Parse DIR_ITEM and extract the target inode.
-	if len(item.Data) < 30 {
-		return 0, fmt.Errorf("DIR_ITEM data too short")
+	// Every name with this hash is packed into the same DIR_ITEM, so the
+	// stored names must be compared to tell colliding entries apart.
+	entries, err := parseDirItems(item.Data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("inode %d DIR_ITEM %d: %w", dirIno, nameHash, err)
+	}
+	for _, entry := range entries {
+		if string(entry.name) == name {
+			location := entry.location
+			return &location, entry.fileType, nil
+		}
 	}
 
-	// DIR_ITEM format: location(key:17) + transid(8) + data_len(2) + name_len(2) + type(1) + name.
-	targetIno := binary.LittleEndian.Uint64(item.Data[0:8])
-
-	return targetIno, nil
+	return nil, 0, fmt.Errorf("%w: %s", errors.ErrPathNotFound, name)
 }
 
-// InodeInfo holds inode information.
+// InodeInfo holds the complete INODE_ITEM of an inode.
 type InodeInfo struct {
-	Ino  uint64
-	Size uint64
-	Mode uint32
+	Ino uint64 `json:"ino"`
+	ondisk.InodeItem
 }
 
-// readInode reads an inode.
-func (fs *FileSystem) readInode(ino uint64) (*InodeInfo, error) {
+// Stat resolves a path and returns the inode it refers to.
+func (fs *FileSystem) Stat(path string) (*InodeInfo, error) {
+	sub, ino, err := fs.lookupPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return sub.StatInode(ino)
+}
+
+// StatInode reads the INODE_ITEM of an inode.
+func (fs *FileSystem) StatInode(ino uint64) (*InodeInfo, error) {
 	key := &btree.Key{
 		ObjectID: ino,
-		Type:     1, // INODE_ITEM
+		Type:     ondisk.KeyTypeInodeItem,
 		Offset:   0,
 	}
 
@@ -398,113 +679,245 @@ func (fs *FileSystem) readInode(ino uint64) (*InodeInfo, error) {
 	}
 
 	item, err := path.GetItem()
-	if err != nil {
-		return nil, err
-	}
-
-	if item.Key.Compare(key) != 0 {
-		return nil, fmt.Errorf("inode %d not found", ino)
+	if err != nil || item.Key.Compare(key) != 0 {
+		return nil, fmt.Errorf("%w: %d", errors.ErrInodeNotFound, ino)
 	}
 
-	// Parse INODE_ITEM.
-	if len(item.Data) < 160 {
-		return nil, fmt.Errorf("INODE_ITEM data too short")
+	info := &InodeInfo{Ino: ino}
+	if err := info.InodeItem.Unmarshal(item.Data); err != nil {
+		return nil, fmt.Errorf("inode %d: %w", ino, err)
 	}
 
-	// INODE_ITEM format: generation(8) + transid(8) + size(8) + ...
-	size := binary.LittleEndian.Uint64(item.Data[16:24])
-	mode := binary.LittleEndian.Uint32(item.Data[52:56])
-
-	return &InodeInfo{
-		Ino:  ino,
-		Size: size,
-		Mode: mode,
-	}, nil
+	return info, nil
 }
 
 // readFileData reads file data.
+// Gaps between extents are left zero-filled and the result is clamped to the
+// inode size.
 func (fs *FileSystem) readFileData(ino uint64, size uint64) ([]byte, error) {
-	// Find EXTENT_DATA.
-	key := &btree.Key{
-		ObjectID: ino,
-		Type:     108, // EXTENT_DATA
-		Offset:   0,
+	buf := make([]byte, size)
+	if err := fs.readRange(ino, 0, buf, nil); err != nil {
+		return nil, err
 	}
+	return buf, nil
+}
 
-	path, err := fs.btreeSearcher.Search(fs.fsTreeRoot, key)
-	if err != nil {
-		return nil, err
+// readExtentData copies the data described by one EXTENT_DATA item into dst,
+// starting skip bytes into the extent. Bytes past len(dst) are dropped.
+// cache, if not nil, keeps the last decompressed extent between calls.
+func (fs *FileSystem) readExtentData(data []byte, skip uint64, dst []byte, cache *extentCache) error {
+	// EXTENT_DATA format: generation(8) + ram_bytes(8) + compression(1) + encryption(1) + other(2) + type(1).
+	if len(data) < 21 {
+		return fmt.Errorf("EXTENT_DATA too short")
 	}
 
-	item, err := path.GetItem()
-	if err != nil {
-		return nil, err
+	ramBytes := binary.LittleEndian.Uint64(data[8:16])
+	compression := data[16]
+	extentType := data[20]
+
+	switch extentType {
+	case ondisk.FileExtentInline:
+		// Data is embedded in the item.
+		inline := data[21:]
+		if compression != ondisk.CompressNone {
+			plain, err := decompress(compression, inline, ramBytes, fs.superblock.SectorSize)
+			if err != nil {
+				return err
+			}
+			inline = plain
+		}
+		if skip < uint64(len(inline)) {
+			copy(dst, inline[skip:])
+		}
+		return nil
+
+	case ondisk.FileExtentReg, ondisk.FileExtentPrealloc:
+		// disk_bytenr(8) + disk_num_bytes(8) + offset(8) + num_bytes(8).
+		if len(data) < 53 {
+			return fmt.Errorf("REGULAR extent data too short")
+		}
+
+		diskBytenr := binary.LittleEndian.Uint64(data[21:29])
+		diskNumBytes := binary.LittleEndian.Uint64(data[29:37])
+		offset := binary.LittleEndian.Uint64(data[37:45])
+		numBytes := binary.LittleEndian.Uint64(data[45:53])
+
+		if skip >= numBytes {
+			return nil
+		}
+		numBytes -= skip
+		offset += skip
+		if numBytes > uint64(len(dst)) {
+			numBytes = uint64(len(dst))
+		}
+
+		// Holes and preallocated extents read back as zeros.
+		if diskBytenr == 0 || extentType == ondisk.FileExtentPrealloc || numBytes == 0 {
+			return nil
+		}
+
+		if compression == ondisk.CompressNone {
+			extent, err := fs.readExtent(diskBytenr+offset, numBytes)
+			if err != nil {
+				return err
+			}
+			copy(dst, extent)
+			return nil
+		}
+
+		// A compressed extent is decoded as a whole; offset and num_bytes
+		// then select the referenced part of the decompressed data.
+		var plain []byte
+		if cache != nil && cache.plain != nil && cache.bytenr == diskBytenr {
+			plain = cache.plain
+		} else {
+			raw, err := fs.readExtent(diskBytenr, diskNumBytes)
+			if err != nil {
+				return err
+			}
+			plain, err = decompress(compression, raw, ramBytes, fs.superblock.SectorSize)
+			if err != nil {
+				return err
+			}
+			if cache != nil {
+				cache.bytenr = diskBytenr
+				cache.plain = plain
+			}
+		}
+		if offset < uint64(len(plain)) {
+			copy(dst[:numBytes], plain[offset:])
+		}
+		return nil
 	}
 
-	// Might not be an exact match, but should be the first EXTENT_DATA.
-	if item.Key.ObjectID != ino || item.Key.Type != 108 {
-		return nil, fmt.Errorf("extent data not found for inode %d", ino)
+	return fmt.Errorf("unsupported extent type: %d", extentType)
+}
+
+// readExtent reads length bytes of extent data starting at a logical address.
+// Whole sectors are read so they can be checked against the csum tree. If
+// the first copy cannot be read or has a bad sector, the data is repaired
+// sector by sector from the other copies.
+func (fs *FileSystem) readExtent(logical uint64, length uint64) ([]byte, error) {
+	sectorSize := uint64(fs.superblock.SectorSize)
+	start := logical / sectorSize * sectorSize
+	end := (logical + length + sectorSize - 1) / sectorSize * sectorSize
+
+	var csums [][]byte
+	if fs.verify {
+		var err error
+		if csums, err = fs.lookupDataCsums(start, end-start); err != nil {
+			return nil, fmt.Errorf("failed to read data checksums: %w", err)
+		}
 	}
 
-	// Parse EXTENT_DATA.
-	if len(item.Data) < 21 {
-		return nil, fmt.Errorf("EXTENT_DATA too short")
+	buf := make([]byte, end-start)
+	err := fs.readLogical(start, buf, 0)
+	if err == nil {
+		err = fs.verifyData(start, buf, csums)
+	}
+	if err != nil && fs.chunkManager.NumCopies(start, end-start) > 1 {
+		if errors.Is(err, errors.ErrDeviceNotFound) {
+			logger.Debug("Copy 1 of data 0x%x is on a missing device, reading it sector by sector: %v", start, err)
+		} else {
+			logger.Warn("Copy 1 of data 0x%x is bad, repairing it sector by sector: %v", start, err)
+		}
+		err = fs.repairData(start, buf, csums)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extent: %w", err)
 	}
 
-	// EXTENT_DATA format: generation(8) + ram_bytes(8) + compression(1) + encryption(1) + other(2) + type(1).
-	extentType := item.Data[20]
+	return buf[logical-start : logical-start+length], nil
+}
 
-	if extentType == 0 { // INLINE
-		// Data is embedded in the item.
-		dataStart := 21
-		if dataStart >= len(item.Data) {
-			return []byte{}, nil
+// repairData reads each sector of buf, which starts at logical address
+// start, from the first copy that passes its checksum. Repairing per sector
+// lets good sectors of different copies be combined, and keeps a bad stripe
+// unit of a RAID5/6 row from spoiling the rebuild of its neighbours.
+func (fs *FileSystem) repairData(start uint64, buf []byte, csums [][]byte) error {
+	sectorSize := uint64(fs.superblock.SectorSize)
+
+	for i := uint64(0); i*sectorSize < uint64(len(buf)); i++ {
+		logical := start + i*sectorSize
+		var sum [][]byte
+		if csums != nil {
+			sum = csums[i : i+1]
 		}
-		return item.Data[dataStart:], nil
-	} else if extentType == 1 { // REGULAR
-		// Need to read a separate extent.
-		if len(item.Data) < 53 {
-			return nil, fmt.Errorf("REGULAR extent data too short")
+
+		err := fs.readMirrors("data", logical, buf[i*sectorSize:(i+1)*sectorSize], func(sector []byte) error {
+			return fs.verifyData(logical, sector, sum)
+		})
+		if err != nil {
+			return err
 		}
+	}
 
-		diskBytenr := binary.LittleEndian.Uint64(item.Data[21:29])
-		diskNumBytes := binary.LittleEndian.Uint64(item.Data[29:37])
-		// offset := binary.LittleEndian.Uint64(item.Data[37:45])
-		numBytes := binary.LittleEndian.Uint64(item.Data[45:53])
+	return nil
+}
 
-		if diskBytenr == 0 {
-			// Sparse file or hole
-			return make([]byte, numBytes), nil
+// readMirrors fills buf from a logical address, trying each copy of a
+// mirrored chunk in turn until one is read and passes check. Failed copies
+// are logged; if every copy fails, the error of the first one is returned.
+func (fs *FileSystem) readMirrors(what string, logical uint64, buf []byte, check func([]byte) error) error {
+	copies := fs.chunkManager.NumCopies(logical, uint64(len(buf)))
+
+	// Copies on missing devices were reported when the filesystem was
+	// opened, so skipping them is only logged at debug level.
+	var firstErr error
+	degraded := false
+	for mirror := 0; mirror < copies; mirror++ {
+		err := fs.readLogical(logical, buf, mirror)
+		if err == nil {
+			err = check(buf)
+		}
+		if err == nil {
+			if mirror > 0 && !degraded {
+				logger.Info("Read %s 0x%x from copy %d of %d", what, logical, mirror+1, copies)
+			}
+			return nil
 		}
 
-		// Read actual data.
-		return fs.readExtent(diskBytenr, diskNumBytes, numBytes)
+		switch {
+		case errors.Is(err, errors.ErrDeviceNotFound):
+			degraded = true
+			logger.Debug("Copy %d of %d of %s 0x%x is on a missing device: %v", mirror+1, copies, what, logical, err)
+		case copies > 1:
+			logger.Warn("Copy %d of %d of %s 0x%x is bad: %v", mirror+1, copies, what, logical, err)
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
 	}
 
-	return nil, fmt.Errorf("unsupported extent type: %d", extentType)
+	return firstErr
 }
 
-// readExtent reads extent data.
-func (fs *FileSystem) readExtent(logical uint64, diskSize uint64, dataSize uint64) ([]byte, error) {
-	// Logical address -> physical address.
-	physAddr, err := fs.chunkManager.LogicalToPhysical(logical)
-	if err != nil {
-		return nil, err
-	}
+// readLogical fills buf from copy mirror of a logical address. The range is
+// mapped through the chunk tree and read one device range at a time, so it
+// may cross stripe units of striped profiles.
+func (fs *FileSystem) readLogical(logical uint64, buf []byte, mirror int) error {
+	return fs.chunkManager.ReadLogical((*deviceReader)(fs), logical, buf, mirror)
+}
 
-	// Read data.
-	buf := make([]byte, diskSize)
-	n, err := fs.device.ReadAt(buf, int64(physAddr.Offset))
-	if err != nil || uint64(n) != diskSize {
-		return nil, fmt.Errorf("failed to read extent: %w", err)
+// deviceReader reads the devices of a filesystem for chunk.Manager.
+type deviceReader FileSystem
+
+// ReadDevice implements chunk.DeviceReader.
+func (r *deviceReader) ReadDevice(devID uint64, p []byte, offset uint64) error {
+	dev, ok := r.devices[devID]
+	if !ok {
+		return fmt.Errorf("%w: device %d is missing", errors.ErrDeviceNotFound, devID)
 	}
 
-	// Simplified: assume no compression.
-	if dataSize < diskSize {
-		return buf[:dataSize], nil
+	n, err := dev.ReadAt(p, int64(offset))
+	if err != nil {
+		return fmt.Errorf("read at physical 0x%x: %w", offset, err)
+	}
+	if n != len(p) {
+		return fmt.Errorf("short read at physical 0x%x: %d of %d bytes", offset, n, len(p))
 	}
 
-	return buf, nil
+	return nil
 }
 
 // crc32Hash computes CRC32 hash (for DIR_ITEM).
@@ -0,0 +1,336 @@
+package fs
+
+import (
+	"io"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// IOFS adapts a FileSystem to the standard io/fs interfaces, so that
+// fs.WalkDir, fs.Glob, template.ParseFS, http.FS and friends can read a
+// Btrfs image directly. Names follow io/fs rules: slash-separated, relative
+// and unrooted, with "." as the root directory.
+type IOFS struct {
+	fsys *FileSystem
+	root string // Absolute path of the subtree served, "/" for the whole filesystem.
+}
+
+var (
+	_ iofs.FS         = (*IOFS)(nil)
+	_ iofs.ReadDirFS  = (*IOFS)(nil)
+	_ iofs.ReadFileFS = (*IOFS)(nil)
+	_ iofs.StatFS     = (*IOFS)(nil)
+	_ iofs.SubFS      = (*IOFS)(nil)
+
+	_ iofs.File        = (*File)(nil)
+	_ iofs.ReadDirFile = (*dirFile)(nil)
+)
+
+// NewIOFS returns an io/fs view of the whole filesystem.
+func NewIOFS(fsys *FileSystem) *IOFS {
+	return &IOFS{fsys: fsys, root: "/"}
+}
+
+// Open implements fs.FS. Directories are returned as fs.ReadDirFile,
+// everything else as a *File.
+func (f *IOFS) Open(name string) (iofs.File, error) {
+	sub, ino, info, err := f.stat("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &dirFile{fsys: sub, ino: ino, info: info}, nil
+	}
+	return &File{fs: sub, ino: ino, size: info.inode.Size, info: info}, nil
+}
+
+// Stat implements fs.StatFS.
+func (f *IOFS) Stat(name string) (iofs.FileInfo, error) {
+	_, _, info, err := f.stat("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (f *IOFS) ReadFile(name string) ([]byte, error) {
+	sub, ino, info, err := f.stat("readfile", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &iofs.PathError{Op: "readfile", Path: name, Err: syscall.EISDIR}
+	}
+
+	data, err := sub.readFileData(ino, info.inode.Size)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// ReadDir implements fs.ReadDirFS. Entries are sorted by name.
+func (f *IOFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	sub, ino, info, err := f.stat("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+
+	entries, err := sub.readDirEntries(ino)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// Sub implements fs.SubFS.
+func (f *IOFS) Sub(dir string) (iofs.FS, error) {
+	_, _, info, err := f.stat("sub", dir, true)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &iofs.PathError{Op: "sub", Path: dir, Err: syscall.ENOTDIR}
+	}
+	return &IOFS{fsys: f.fsys, root: path.Join(f.root, dir)}, nil
+}
+
+// Lstat returns the FileInfo of name without following a symlink in the
+// last component. Together with ReadLink it implements fs.ReadLinkFS on
+// Go 1.25 and later.
+func (f *IOFS) Lstat(name string) (iofs.FileInfo, error) {
+	_, _, info, err := f.stat("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadLink returns the target of the symbolic link name.
+func (f *IOFS) ReadLink(name string) (string, error) {
+	sub, ino, _, err := f.stat("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := sub.readlinkInode(ino)
+	if err != nil {
+		return "", &iofs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+// stat validates an io/fs name and resolves it to an inode and the
+// subvolume holding it. Symlinks are followed like in os.DirFS, except in
+// the last component when follow is false.
+func (f *IOFS) stat(op, name string, follow bool) (*FileSystem, uint64, *fileInfo, error) {
+	if !iofs.ValidPath(name) {
+		return nil, 0, nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+
+	sub, ino, err := f.fsys.resolvePath(path.Join(f.root, name), follow)
+	if err != nil {
+		switch {
+		case errors.Is(err, errors.ErrPathNotFound):
+			err = iofs.ErrNotExist
+		case errors.Is(err, errors.ErrNotDirectory):
+			// A path through a regular file, like os.DirFS reports it.
+			err = syscall.ENOTDIR
+		}
+		return nil, 0, nil, &iofs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	inode, err := sub.StatInode(ino)
+	if err != nil {
+		return nil, 0, nil, &iofs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	return sub, ino, &fileInfo{name: path.Base(name), inode: inode}, nil
+}
+
+// readDirEntries lists a directory as io/fs entries sorted by name.
+func (fs *FileSystem) readDirEntries(dirIno uint64) ([]iofs.DirEntry, error) {
+	entries, err := fs.listDirectory(dirIno)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]iofs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, &dirEntry{fsys: fs, entry: entry})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+// fileInfo implements fs.FileInfo from an INODE_ITEM.
+type fileInfo struct {
+	name  string
+	inode *InodeInfo
+}
+
+func (fi *fileInfo) Name() string        { return fi.name }
+func (fi *fileInfo) Size() int64         { return int64(fi.inode.Size) }
+func (fi *fileInfo) Mode() iofs.FileMode { return fileMode(fi.inode.Mode) }
+func (fi *fileInfo) ModTime() time.Time  { return fi.inode.MTime.Time() }
+func (fi *fileInfo) IsDir() bool         { return fi.Mode().IsDir() }
+
+// Sys returns the underlying *InodeInfo.
+func (fi *fileInfo) Sys() any { return fi.inode }
+
+// fileMode converts a POSIX st_mode to an fs.FileMode.
+func fileMode(mode uint32) iofs.FileMode {
+	m := iofs.FileMode(mode & 0777)
+	if mode&04000 != 0 {
+		m |= iofs.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= iofs.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= iofs.ModeSticky
+	}
+
+	switch mode & ondisk.ModeTypeMask {
+	case ondisk.ModeDir:
+		m |= iofs.ModeDir
+	case ondisk.ModeSymlink:
+		m |= iofs.ModeSymlink
+	case ondisk.ModeCharDev:
+		m |= iofs.ModeDevice | iofs.ModeCharDevice
+	case ondisk.ModeBlockDev:
+		m |= iofs.ModeDevice
+	case ondisk.ModeFifo:
+		m |= iofs.ModeNamedPipe
+	case ondisk.ModeSocket:
+		m |= iofs.ModeSocket
+	}
+	return m
+}
+
+// FileMode returns the inode mode as an fs.FileMode.
+func (i *InodeInfo) FileMode() iofs.FileMode {
+	return fileMode(i.Mode)
+}
+
+// dirEntry implements fs.DirEntry. The type comes from the directory item;
+// the inode is read only when Info is called.
+type dirEntry struct {
+	fsys  *FileSystem
+	entry *DirEntry
+}
+
+func (d *dirEntry) Name() string { return d.entry.Name }
+func (d *dirEntry) IsDir() bool  { return d.entry.IsDir }
+
+// Type maps the BTRFS_FT_* type of the directory item to fs.FileMode bits.
+func (d *dirEntry) Type() iofs.FileMode {
+	switch d.entry.Type {
+	case ondisk.FtDir:
+		return iofs.ModeDir
+	case ondisk.FtSymlink:
+		return iofs.ModeSymlink
+	case ondisk.FtChrdev:
+		return iofs.ModeDevice | iofs.ModeCharDevice
+	case ondisk.FtBlkdev:
+		return iofs.ModeDevice
+	case ondisk.FtFifo:
+		return iofs.ModeNamedPipe
+	case ondisk.FtSock:
+		return iofs.ModeSocket
+	}
+	return 0
+}
+
+// Info reads the inode of the entry, in the linked subvolume's tree if the
+// entry is a subvolume.
+func (d *dirEntry) Info() (iofs.FileInfo, error) {
+	fsys := d.fsys
+	if d.entry.Subvolume != 0 {
+		sub, err := fsys.OpenSubvolume(d.entry.Subvolume)
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	inode, err := fsys.StatInode(d.entry.Inode)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: d.entry.Name, inode: inode}, nil
+}
+
+// dirFile is an open directory. Entries are loaded on the first ReadDir.
+type dirFile struct {
+	fsys    *FileSystem
+	ino     uint64
+	info    *fileInfo
+	entries []iofs.DirEntry
+	loaded  bool
+	closed  bool
+}
+
+func (d *dirFile) Stat() (iofs.FileInfo, error) {
+	if d.closed {
+		return nil, iofs.ErrClosed
+	}
+	return d.info, nil
+}
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.info.name, Err: syscall.EISDIR}
+}
+
+func (d *dirFile) Close() error {
+	if d.closed {
+		return iofs.ErrClosed
+	}
+	d.closed = true
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *dirFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if d.closed {
+		return nil, iofs.ErrClosed
+	}
+
+	if !d.loaded {
+		entries, err := d.fsys.readDirEntries(d.ino)
+		if err != nil {
+			return nil, &iofs.PathError{Op: "readdir", Path: d.info.name, Err: err}
+		}
+		d.entries = entries
+		d.loaded = true
+	}
+
+	if n <= 0 {
+		rest := d.entries
+		d.entries = nil
+		return rest, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	batch := d.entries[:n]
+	d.entries = d.entries[n:]
+	return batch, nil
+}
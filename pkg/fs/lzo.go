@@ -0,0 +1,248 @@
+package fs
+
+import (
+	"fmt"
+)
+
+// lzo1xDecoder holds the state of an LZO1X decompression.
+type lzo1xDecoder struct {
+	in  []byte
+	out []byte
+	ip  int
+	op  int
+}
+
+// lzo1xDecompress decodes a raw LZO1X stream into dst and returns the number
+// of bytes written. It follows lzo1x_decompress_safe and rejects any input
+// that would read or write out of bounds.
+func lzo1xDecompress(src, dst []byte) (int, error) {
+	d := &lzo1xDecoder{in: src, out: dst}
+	if err := d.run(); err != nil {
+		return 0, err
+	}
+	return d.op, nil
+}
+
+// LZO1X decoder states, named after the labels in lzo1x_decompress_safe.
+const (
+	lzoLiteralRun   = iota // Instruction below 16 starts a literal run.
+	lzoFirstLiteral        // Instruction below 16 is a 3-byte M1 match.
+	lzoMatch               // Instruction below 16 is a 2-byte M1 match.
+)
+
+func (d *lzo1xDecoder) run() error {
+	if len(d.in) == 0 {
+		return fmt.Errorf("lzo1x: empty input")
+	}
+
+	state := lzoLiteralRun
+	t := 0
+
+	// A first byte above 17 encodes an initial literal run.
+	if d.in[0] > 17 {
+		t = int(d.in[0]) - 17
+		d.ip++
+		if err := d.copyLiterals(t); err != nil {
+			return err
+		}
+		state = lzoFirstLiteral
+		if t < 4 {
+			next, err := d.next()
+			if err != nil {
+				return err
+			}
+			t = next
+			state = lzoMatch
+		}
+	}
+
+	for {
+		switch state {
+		case lzoLiteralRun, lzoFirstLiteral:
+			next, err := d.next()
+			if err != nil {
+				return err
+			}
+			t = next
+			if t >= 16 {
+				state = lzoMatch
+				continue
+			}
+
+			if state == lzoLiteralRun {
+				if t == 0 {
+					if t, err = d.extendedLength(15); err != nil {
+						return err
+					}
+				}
+				if err := d.copyLiterals(t + 3); err != nil {
+					return err
+				}
+				state = lzoFirstLiteral
+				continue
+			}
+
+			// M1 after a literal run: 3 bytes at distance 2049-3072.
+			b, err := d.next()
+			if err != nil {
+				return err
+			}
+			if err := d.copyMatch(1+0x0800+(t>>2)+(b<<2), 3); err != nil {
+				return err
+			}
+
+		case lzoMatch:
+			done, err := d.match(t)
+			if err != nil || done {
+				return err
+			}
+		}
+
+		// The low two bits of the byte two positions back encode up to
+		// three literals that follow the match.
+		n := int(d.in[d.ip-2] & 3)
+		if n == 0 {
+			state = lzoLiteralRun
+			continue
+		}
+		if err := d.copyLiterals(n); err != nil {
+			return err
+		}
+		next, err := d.next()
+		if err != nil {
+			return err
+		}
+		t = next
+		state = lzoMatch
+	}
+}
+
+// match decodes and copies one match instruction. It returns true at the
+// end-of-stream marker.
+func (d *lzo1xDecoder) match(t int) (bool, error) {
+	var dist, length int
+	var err error
+
+	switch {
+	case t >= 64: // M2: 3-8 bytes within 2KiB.
+		b, err := d.next()
+		if err != nil {
+			return false, err
+		}
+		dist = 1 + ((t >> 2) & 7) + (b << 3)
+		length = (t >> 5) + 1
+
+	case t >= 32: // M3: distance up to 16KiB.
+		length = t & 31
+		if length == 0 {
+			if length, err = d.extendedLength(31); err != nil {
+				return false, err
+			}
+		}
+		length += 2
+		v, err := d.le16()
+		if err != nil {
+			return false, err
+		}
+		dist = 1 + (v >> 2)
+
+	case t >= 16: // M4: distance 16KiB-48KiB, or the end of stream.
+		high := (t & 8) << 11
+		length = t & 7
+		if length == 0 {
+			if length, err = d.extendedLength(7); err != nil {
+				return false, err
+			}
+		}
+		length += 2
+		v, err := d.le16()
+		if err != nil {
+			return false, err
+		}
+		dist = high + (v >> 2)
+		if dist == 0 {
+			return true, nil
+		}
+		dist += 0x4000
+
+	default: // M1: 2 bytes within 1KiB, only after a match.
+		b, err := d.next()
+		if err != nil {
+			return false, err
+		}
+		dist = 1 + (t >> 2) + (b << 2)
+		length = 2
+	}
+
+	return false, d.copyMatch(dist, length)
+}
+
+// next reads one input byte.
+func (d *lzo1xDecoder) next() (int, error) {
+	if d.ip >= len(d.in) {
+		return 0, fmt.Errorf("lzo1x: input overrun at %d", d.ip)
+	}
+	b := d.in[d.ip]
+	d.ip++
+	return int(b), nil
+}
+
+// le16 reads a little-endian 16-bit value.
+func (d *lzo1xDecoder) le16() (int, error) {
+	if d.ip+2 > len(d.in) {
+		return 0, fmt.Errorf("lzo1x: input overrun at %d", d.ip)
+	}
+	v := int(d.in[d.ip]) | int(d.in[d.ip+1])<<8
+	d.ip += 2
+	return v, nil
+}
+
+// extendedLength decodes a run of zero bytes (255 each) and a final
+// non-zero byte added to base.
+func (d *lzo1xDecoder) extendedLength(base int) (int, error) {
+	length := base
+	for {
+		b, err := d.next()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0 {
+			return length + b, nil
+		}
+		length += 255
+		if length > len(d.out)+len(d.in) {
+			return 0, fmt.Errorf("lzo1x: length overflow at %d", d.ip)
+		}
+	}
+}
+
+// copyLiterals copies n bytes from input to output.
+func (d *lzo1xDecoder) copyLiterals(n int) error {
+	if d.ip+n > len(d.in) {
+		return fmt.Errorf("lzo1x: input overrun at %d", d.ip)
+	}
+	if d.op+n > len(d.out) {
+		return fmt.Errorf("lzo1x: output overrun at %d", d.op)
+	}
+	copy(d.out[d.op:], d.in[d.ip:d.ip+n])
+	d.ip += n
+	d.op += n
+	return nil
+}
+
+// copyMatch copies length bytes from dist bytes back in the output.
+// The regions may overlap, so bytes are copied one at a time.
+func (d *lzo1xDecoder) copyMatch(dist, length int) error {
+	if dist > d.op {
+		return fmt.Errorf("lzo1x: lookbehind overrun at %d", d.op)
+	}
+	if d.op+length > len(d.out) {
+		return fmt.Errorf("lzo1x: output overrun at %d", d.op)
+	}
+	pos := d.op - dist
+	for i := 0; i < length; i++ {
+		d.out[d.op] = d.out[pos+i]
+		d.op++
+	}
+	return nil
+}
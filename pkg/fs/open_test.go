@@ -0,0 +1,193 @@
+package fs
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/btree"
+	"github.com/WinBeyond/btrfs-read/pkg/device"
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+func TestBackupRootSlots(t *testing.T) {
+	sb := &ondisk.Superblock{Root: 0x9000, ChunkRoot: 0x1000}
+	sb.SuperRoots[0] = ondisk.RootBackup{TreeRoot: 0x7000, TreeRootGen: 8, ChunkRoot: 0x1000}
+	sb.SuperRoots[1] = ondisk.RootBackup{TreeRoot: 0x9000, TreeRootGen: 10, ChunkRoot: 0x1000} // current roots
+	sb.SuperRoots[2] = ondisk.RootBackup{}                                                     // never written
+	sb.SuperRoots[3] = ondisk.RootBackup{TreeRoot: 0x8000, TreeRootGen: 9, ChunkRoot: 0x1000}
+
+	tests := []struct {
+		limit int
+		want  []int
+	}{
+		{0, nil},
+		{-1, nil},
+		{1, []int{3}},
+		{ondisk.NumBackupRoots, []int{3, 0}},
+	}
+	for _, tt := range tests {
+		if got := backupRootSlots(sb, tt.limit); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("backupRootSlots(%d) = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+// testItem is an item of a leaf built by makeLeaf.
+type testItem struct {
+	key  btree.Key
+	data []byte
+}
+
+// makeLeaf builds a 4 KiB leaf for logical address addr holding items,
+// which must be sorted, checksummed with CRC32C.
+func makeLeaf(fsid [16]byte, addr, owner uint64, items []testItem) []byte {
+	le := binary.LittleEndian
+	buf := make([]byte, 4096)
+	copy(buf[32:48], fsid[:])
+	le.PutUint64(buf[48:], addr)
+	le.PutUint64(buf[80:], 10) // generation
+	le.PutUint64(buf[88:], owner)
+	le.PutUint32(buf[96:], uint32(len(items)))
+
+	end := len(buf)
+	for i, item := range items {
+		end -= len(item.data)
+		copy(buf[end:], item.data)
+
+		p := buf[btree.HeaderSize+i*25:]
+		le.PutUint64(p[0:], item.key.ObjectID)
+		p[8] = item.key.Type
+		le.PutUint64(p[9:], item.key.Offset)
+		le.PutUint32(p[17:], uint32(end-btree.HeaderSize))
+		le.PutUint32(p[21:], uint32(len(item.data)))
+	}
+
+	sum, _ := ondisk.Checksum(ondisk.CsumTypeCRC32C, buf[ondisk.ChecksumSize:])
+	copy(buf, sum[:])
+	return buf
+}
+
+// writeTornImage writes a single-device image whose current root tree
+// block is corrupt, as after a crash that tore the last transaction, and
+// whose backup root slot 2 holds the intact root tree of the transaction
+// before. Everything lives in one SINGLE chunk mapped 1:1 to the device.
+func writeTornImage(t *testing.T) string {
+	t.Helper()
+
+	const (
+		chunkStart = 0x100000
+		chunkLen   = 0x100000
+		chunkLeaf  = chunkStart
+		goodRoot   = chunkStart + 0x1000
+		fsLeaf     = chunkStart + 0x2000
+		tornRoot   = chunkStart + 0x3000
+
+		firstChunkTreeObjectid = 256 // Objectid of every CHUNK_ITEM
+	)
+	le := binary.LittleEndian
+	fsid := [16]byte{0xf5}
+	devUUID := [16]byte{0xde}
+
+	devItem := make([]byte, 98)
+	le.PutUint64(devItem[0:], 1) // devid
+	le.PutUint64(devItem[8:], 2*chunkStart+chunkLen)
+	le.PutUint64(devItem[16:], chunkLen)
+	copy(devItem[66:], devUUID[:])
+	copy(devItem[82:], fsid[:])
+
+	chunkItem := make([]byte, 48+32)
+	le.PutUint64(chunkItem[0:], chunkLen)
+	le.PutUint64(chunkItem[8:], ondisk.ExtentTreeObjectid)
+	le.PutUint64(chunkItem[16:], 64<<10) // stripe_len
+	le.PutUint64(chunkItem[24:], ondisk.BlockGroupSystem|ondisk.BlockGroupMetadata)
+	le.PutUint32(chunkItem[40:], 4096)
+	le.PutUint16(chunkItem[44:], 1) // num_stripes
+	le.PutUint64(chunkItem[48:], 1) // stripe devid
+	le.PutUint64(chunkItem[56:], chunkStart)
+	copy(chunkItem[64:], devUUID[:])
+
+	rootItem := make([]byte, ondisk.RootItemSize)
+	le.PutUint64(rootItem[160:], 9) // generation
+	le.PutUint64(rootItem[168:], ondisk.FirstFreeObjectid)
+	le.PutUint64(rootItem[176:], fsLeaf)
+
+	img := make([]byte, 2*chunkStart+chunkLen)
+	copy(img[chunkLeaf:], makeLeaf(fsid, chunkLeaf, ondisk.ChunkTreeObjectid, []testItem{
+		{btree.Key{ObjectID: ondisk.DevItemsObjectid, Type: ondisk.KeyTypeDevItem, Offset: 1}, devItem},
+		{btree.Key{ObjectID: firstChunkTreeObjectid, Type: ondisk.KeyTypeChunkItem, Offset: chunkStart}, chunkItem},
+	}))
+	copy(img[goodRoot:], makeLeaf(fsid, goodRoot, ondisk.RootTreeObjectid, []testItem{
+		{btree.Key{ObjectID: ondisk.FsTreeObjectid, Type: ondisk.KeyTypeRootItem}, rootItem},
+	}))
+	copy(img[fsLeaf:], makeLeaf(fsid, fsLeaf, ondisk.FsTreeObjectid, nil))
+	copy(img[tornRoot:], makeLeaf(fsid, tornRoot, ondisk.RootTreeObjectid, []testItem{
+		{btree.Key{ObjectID: ondisk.FsTreeObjectid, Type: ondisk.KeyTypeRootItem}, rootItem},
+	}))
+	img[tornRoot+2000] ^= 0xff
+
+	sb := img[device.SuperblockOffset:]
+	copy(sb[32:], fsid[:])
+	le.PutUint64(sb[48:], uint64(device.SuperblockOffset))
+	copy(sb[64:], ondisk.BtrfsMagic[:])
+	le.PutUint64(sb[72:], 10) // generation
+	le.PutUint64(sb[80:], tornRoot)
+	le.PutUint64(sb[88:], chunkLeaf)
+	le.PutUint64(sb[112:], uint64(len(img)))
+	le.PutUint64(sb[128:], 6) // root_dir_objectid
+	le.PutUint64(sb[136:], 1) // num_devices
+	le.PutUint32(sb[144:], 4096)
+	le.PutUint32(sb[148:], 4096)
+	le.PutUint32(sb[152:], 4096)
+	copy(sb[201:], devItem)
+
+	// sys_chunk_array: the key and item of the only chunk.
+	le.PutUint32(sb[160:], 17+uint32(len(chunkItem)))
+	le.PutUint64(sb[811:], firstChunkTreeObjectid)
+	sb[811+8] = ondisk.KeyTypeChunkItem
+	le.PutUint64(sb[811+9:], chunkStart)
+	copy(sb[811+17:], chunkItem)
+
+	// Backup slot 2 records the previous transaction.
+	backup := sb[2859+2*ondisk.RootBackupSize:]
+	le.PutUint64(backup[0:], goodRoot)
+	le.PutUint64(backup[8:], 9)
+	le.PutUint64(backup[16:], chunkLeaf)
+	le.PutUint64(backup[24:], 9)
+
+	sum, _ := ondisk.Checksum(ondisk.CsumTypeCRC32C, sb[ondisk.ChecksumSize:ondisk.SuperblockSize])
+	copy(sb, sum[:])
+
+	path := filepath.Join(t.TempDir(), "torn.img")
+	if err := os.WriteFile(path, img, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenBackupRoot(t *testing.T) {
+	path := writeTornImage(t)
+
+	// Without the fallback the torn root tree fails the open.
+	_, err := OpenWithOptions(path, OpenOptions{})
+	if !errors.Is(err, errors.ErrInvalidChecksum) || !strings.Contains(err.Error(), "0x103000") {
+		t.Fatalf("open without backup roots: expected ErrInvalidChecksum for block 0x103000, got %v", err)
+	}
+
+	fs, err := OpenWithOptions(path, OpenOptions{UseBackupRoot: 1})
+	if err != nil {
+		t.Fatalf("open with one backup root failed: %v", err)
+	}
+	defer fs.Close()
+
+	if got := fs.BackupRoot(); got != 2 {
+		t.Errorf("BackupRoot = %d, want 2", got)
+	}
+	if fs.SubvolumeID() != ondisk.FsTreeObjectid || fs.fsTreeRoot != 0x102000 {
+		t.Errorf("opened subvolume %d at 0x%x, want 5 at 0x102000", fs.SubvolumeID(), fs.fsTreeRoot)
+	}
+}
@@ -0,0 +1,299 @@
+package fs
+
+import (
+	"encoding/binary"
+	"fmt"
+	gopath "path"
+	"sort"
+	"strings"
+
+	"github.com/WinBeyond/btrfs-read/pkg/btree"
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// Subvolume describes a subvolume or snapshot registered in the Root Tree.
+type Subvolume struct {
+	ID           uint64          `json:"id"`
+	ParentID     uint64          `json:"parent_id"`  // Subvolume containing the link
+	DirID        uint64          `json:"dir_id"`     // Directory inode of the link in the parent
+	Name         string          `json:"name"`       // Name of the link
+	Path         string          `json:"path"`       // Path from the top-level subvolume
+	Generation   uint64          `json:"generation"` // Last transaction that modified it
+	OTransID     uint64          `json:"otransid"`   // Transaction of creation
+	CTime        ondisk.Timespec `json:"ctime"`
+	OTime        ondisk.Timespec `json:"otime"`
+	UUID         ondisk.UUID     `json:"uuid"`
+	ParentUUID   ondisk.UUID     `json:"parent_uuid"` // Source subvolume, for snapshots
+	ReceivedUUID ondisk.UUID     `json:"received_uuid"`
+	Readonly     bool            `json:"readonly"`
+}
+
+// IsSnapshot reports whether the subvolume was created as a snapshot.
+func (s *Subvolume) IsSnapshot() bool {
+	return !s.ParentUUID.IsZero()
+}
+
+// SubvolumeID returns the ID of the subvolume this filesystem browses.
+func (fs *FileSystem) SubvolumeID() uint64 {
+	return fs.subvolID
+}
+
+// DefaultSubvolumeID returns the subvolume selected with
+// "btrfs subvolume set-default", which Open browses. It is recorded as the
+// "default" DIR_ITEM of the root tree directory; without one it is the
+// top-level subvolume (ID 5).
+func (fs *FileSystem) DefaultSubvolumeID() (uint64, error) {
+	return fs.defaultSubvolumeID()
+}
+
+func (fs *FileSystem) defaultSubvolumeID() (uint64, error) {
+	const name = "default"
+
+	key := &btree.Key{
+		ObjectID: ondisk.RootTreeDirObjectid,
+		Type:     ondisk.KeyTypeDirItem,
+		Offset:   crc32Hash([]byte(name)),
+	}
+
+	id := ondisk.FsTreeObjectid
+	err := fs.btreeSearcher.Walk(fs.superblock.Root, key, func(item *btree.Item) (bool, error) {
+		if item.Key.Compare(key) != 0 {
+			return false, nil
+		}
+
+		entries, err := parseDirItems(item.Data)
+		if err != nil {
+			return false, fmt.Errorf("default subvolume DIR_ITEM: %w", err)
+		}
+		for _, entry := range entries {
+			if string(entry.name) == name {
+				id = entry.location.ObjectID
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// OpenSubvolume returns a filesystem that browses the subvolume or snapshot
+// with the given ID; ID 5 is the top-level subvolume. The result shares the
+// device with fs and stays valid until fs is closed.
+func (fs *FileSystem) OpenSubvolume(id uint64) (*FileSystem, error) {
+	if id != ondisk.FsTreeObjectid && (id < ondisk.FirstFreeObjectid || id > ondisk.LastFreeObjectid) {
+		return nil, fmt.Errorf("%w: %d is not a subvolume ID", errors.ErrSubvolumeNotFound, id)
+	}
+
+	root, err := fs.readRootItem(id)
+	if err != nil {
+		return nil, err
+	}
+	if root.Refs == 0 {
+		return nil, fmt.Errorf("%w: subvolume %d is deleted", errors.ErrSubvolumeNotFound, id)
+	}
+
+	view := *fs
+	view.fsTreeRoot = root.ByteNr
+	view.subvolID = id
+	view.view = true
+	return &view, nil
+}
+
+// OpenSubvolumeByPath opens a subvolume by its path from the top-level
+// subvolume, as shown by ListSubvolumes. "/" opens the top level itself.
+func (fs *FileSystem) OpenSubvolumeByPath(path string) (*FileSystem, error) {
+	clean := strings.Trim(gopath.Clean("/"+path), "/")
+	if clean == "" {
+		return fs.OpenSubvolume(ondisk.FsTreeObjectid)
+	}
+
+	subvols, err := fs.ListSubvolumes()
+	if err != nil {
+		return nil, err
+	}
+	for _, sv := range subvols {
+		if sv.Path == clean {
+			return fs.OpenSubvolume(sv.ID)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errors.ErrSubvolumeNotFound, path)
+}
+
+// OpenSubvolumeByUUID opens the subvolume with the given UUID.
+func (fs *FileSystem) OpenSubvolumeByUUID(uuid ondisk.UUID) (*FileSystem, error) {
+	subvols, err := fs.ListSubvolumes()
+	if err != nil {
+		return nil, err
+	}
+	for _, sv := range subvols {
+		if sv.UUID == uuid {
+			return fs.OpenSubvolume(sv.ID)
+		}
+	}
+	return nil, fmt.Errorf("%w: uuid %s", errors.ErrSubvolumeNotFound, uuid)
+}
+
+// maxSubvolumeDepth bounds path resolution through nested subvolumes and
+// directories, so corrupted back references cannot loop forever.
+const maxSubvolumeDepth = 4096
+
+// ListSubvolumes returns every subvolume and snapshot sorted by ID. The
+// top-level subvolume (ID 5) is not included, and neither are deleted
+// subvolumes that are no longer linked anywhere.
+func (fs *FileSystem) ListSubvolumes() ([]*Subvolume, error) {
+	roots := make(map[uint64]*ondisk.RootItem)
+	refs := make(map[uint64]*Subvolume)
+
+	// ROOT_ITEM (id, ROOT_ITEM, 0|transid), ROOT_BACKREF (child, ROOT_BACKREF,
+	// parent) and ROOT_REF (parent, ROOT_REF, child) items of subvolumes all
+	// sort between the top-level tree and the last free objectid.
+	start := &btree.Key{ObjectID: ondisk.FsTreeObjectid, Type: 0, Offset: 0}
+	err := fs.btreeSearcher.Walk(fs.superblock.Root, start, func(item *btree.Item) (bool, error) {
+		id := item.Key.ObjectID
+		if id > ondisk.LastFreeObjectid {
+			return false, nil
+		}
+		if id != ondisk.FsTreeObjectid && id < ondisk.FirstFreeObjectid {
+			return true, nil
+		}
+
+		switch item.Key.Type {
+		case ondisk.KeyTypeRootItem:
+			root := &ondisk.RootItem{}
+			if err := root.Unmarshal(item.Data); err != nil {
+				return false, fmt.Errorf("ROOT_ITEM %d: %w", id, err)
+			}
+			roots[id] = root
+
+		case ondisk.KeyTypeRootBackref, ondisk.KeyTypeRootRef:
+			child, parent := id, item.Key.Offset
+			if item.Key.Type == ondisk.KeyTypeRootRef {
+				child, parent = item.Key.Offset, id
+			}
+			if refs[child] != nil {
+				return true, nil
+			}
+
+			var ref ondisk.RootRef
+			if err := ref.Unmarshal(item.Data); err != nil {
+				return false, fmt.Errorf("root ref %d -> %d: %w", parent, child, err)
+			}
+			refs[child] = &Subvolume{ID: child, ParentID: parent, DirID: ref.DirID, Name: ref.Name}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	subvols := make([]*Subvolume, 0, len(refs))
+	for id, sv := range refs {
+		root, ok := roots[id]
+		if !ok {
+			continue
+		}
+		sv.Generation = root.Generation
+		sv.OTransID = root.OTransID
+		sv.CTime = root.CTime
+		sv.OTime = root.OTime
+		sv.UUID = root.UUID
+		sv.ParentUUID = root.ParentUUID
+		sv.ReceivedUUID = root.ReceivedUUID
+		sv.Readonly = root.IsReadonly()
+		subvols = append(subvols, sv)
+	}
+
+	for _, sv := range subvols {
+		path, err := fs.subvolumePath(sv, refs, roots)
+		if err != nil {
+			return nil, err
+		}
+		sv.Path = path
+	}
+
+	sort.Slice(subvols, func(i, j int) bool {
+		return subvols[i].ID < subvols[j].ID
+	})
+	return subvols, nil
+}
+
+// subvolumePath builds the path of a subvolume from the top level by
+// following ROOT_BACKREFs up to ID 5 and INODE_REFs inside each parent.
+func (fs *FileSystem) subvolumePath(sv *Subvolume, refs map[uint64]*Subvolume, roots map[uint64]*ondisk.RootItem) (string, error) {
+	path := ""
+	for depth := 0; ; depth++ {
+		if depth > maxSubvolumeDepth {
+			return "", fmt.Errorf("subvolume %d: back references loop", sv.ID)
+		}
+
+		parentRoot, ok := roots[sv.ParentID]
+		if !ok {
+			return "", fmt.Errorf("subvolume %d: parent %d has no ROOT_ITEM", sv.ID, sv.ParentID)
+		}
+
+		dir, err := fs.inodePath(parentRoot.ByteNr, sv.DirID)
+		if err != nil {
+			return "", fmt.Errorf("subvolume %d: %w", sv.ID, err)
+		}
+		path = gopath.Join(dir, sv.Name, path)
+
+		if sv.ParentID == ondisk.FsTreeObjectid {
+			return path, nil
+		}
+		parent, ok := refs[sv.ParentID]
+		if !ok {
+			return "", fmt.Errorf("subvolume %d: parent %d is not linked", sv.ID, sv.ParentID)
+		}
+		sv = parent
+	}
+}
+
+// inodePath returns the path of a directory inode relative to the root
+// directory of the tree at treeRoot, following INODE_REF items upwards.
+func (fs *FileSystem) inodePath(treeRoot uint64, ino uint64) (string, error) {
+	path := ""
+	for depth := 0; ino != ondisk.FirstFreeObjectid; depth++ {
+		if depth > maxSubvolumeDepth {
+			return "", fmt.Errorf("inode %d: INODE_REF loop", ino)
+		}
+
+		key := &btree.Key{
+			ObjectID: ino,
+			Type:     ondisk.KeyTypeInodeRef,
+			Offset:   0,
+		}
+
+		var parent uint64
+		var name string
+		err := fs.btreeSearcher.Walk(treeRoot, key, func(item *btree.Item) (bool, error) {
+			if item.Key.ObjectID != ino || item.Key.Type != ondisk.KeyTypeInodeRef {
+				return false, nil
+			}
+
+			// INODE_REF format: index (8) + name_len (2) + name.
+			if len(item.Data) < 10 {
+				return false, fmt.Errorf("inode %d INODE_REF too short", ino)
+			}
+			nameLen := int(binary.LittleEndian.Uint16(item.Data[8:10]))
+			if len(item.Data) < 10+nameLen {
+				return false, fmt.Errorf("inode %d INODE_REF name out of bounds", ino)
+			}
+			parent = item.Key.Offset
+			name = string(item.Data[10 : 10+nameLen])
+			return false, nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if name == "" {
+			return "", fmt.Errorf("inode %d has no INODE_REF", ino)
+		}
+
+		path = gopath.Join(name, path)
+		ino = parent
+	}
+	return path, nil
+}
@@ -0,0 +1,46 @@
+package fs
+
+import (
+	"fmt"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// Readlink returns the target of a symbolic link. A symlink in the last
+// path component is not followed.
+func (fs *FileSystem) Readlink(path string) (string, error) {
+	sub, ino, err := fs.resolvePath(path, false)
+	if err != nil {
+		return "", err
+	}
+	return sub.readlinkInode(ino)
+}
+
+// Lstat is like Stat but does not follow a symlink in the last path
+// component, so it returns the inode of the link itself.
+func (fs *FileSystem) Lstat(path string) (*InodeInfo, error) {
+	sub, ino, err := fs.resolvePath(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return sub.StatInode(ino)
+}
+
+// readlinkInode reads the target of a symlink inode. The target is stored
+// as file data, normally a single inline extent.
+func (fs *FileSystem) readlinkInode(ino uint64) (string, error) {
+	info, err := fs.StatInode(ino)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode&ondisk.ModeTypeMask != ondisk.ModeSymlink {
+		return "", fmt.Errorf("%w: inode %d", errors.ErrNotSymlink, ino)
+	}
+
+	target, err := fs.readFileData(ino, info.Size)
+	if err != nil {
+		return "", fmt.Errorf("symlink inode %d: %w", ino, err)
+	}
+	return string(target), nil
+}
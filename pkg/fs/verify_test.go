@@ -0,0 +1,83 @@
+package fs
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// makeTreeBlock builds a node header for logical address addr, stamped
+// with fsid and checksummed with csumType.
+func makeTreeBlock(csumType uint16, fsid [16]byte, addr uint64) []byte {
+	buf := make([]byte, 4096)
+	copy(buf[32:48], fsid[:])
+	binary.LittleEndian.PutUint64(buf[48:], addr)
+	sum, _ := ondisk.Checksum(csumType, buf[ondisk.ChecksumSize:])
+	copy(buf, sum[:])
+	return buf
+}
+
+func TestVerifyNode(t *testing.T) {
+	fsid := [16]byte{1, 2, 3}
+	fs := &FileSystem{superblock: &ondisk.Superblock{FSID: fsid, CsumType: ondisk.CsumTypeXXHash}}
+
+	if err := fs.verifyNode(0x4000, makeTreeBlock(ondisk.CsumTypeXXHash, fsid, 0x4000)); err != nil {
+		t.Errorf("verifyNode rejected a good block: %v", err)
+	}
+
+	corrupt := makeTreeBlock(ondisk.CsumTypeXXHash, fsid, 0x4000)
+	corrupt[200] ^= 0xff
+	misdirected := makeTreeBlock(ondisk.CsumTypeXXHash, fsid, 0x8000)
+	foreign := makeTreeBlock(ondisk.CsumTypeXXHash, [16]byte{9}, 0x4000)
+
+	for name, buf := range map[string][]byte{"corrupt": corrupt, "misdirected": misdirected, "foreign": foreign} {
+		if err := fs.verifyNode(0x4000, buf); !errors.Is(err, errors.ErrInvalidChecksum) {
+			t.Errorf("%s block: expected ErrInvalidChecksum, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifyNodeMetadataUUID(t *testing.T) {
+	metaUUID := [16]byte{4, 5, 6}
+	fs := &FileSystem{superblock: &ondisk.Superblock{
+		FSID:          [16]byte{1, 2, 3},
+		MetadataUUID:  metaUUID,
+		IncompatFlags: ondisk.IncompatMetadataUUID,
+		CsumType:      ondisk.CsumTypeCRC32C,
+	}}
+
+	// After "btrfstune -m" tree blocks keep the original FSID, which is
+	// recorded as the metadata UUID.
+	if err := fs.verifyNode(0x4000, makeTreeBlock(ondisk.CsumTypeCRC32C, metaUUID, 0x4000)); err != nil {
+		t.Errorf("verifyNode rejected a block with the metadata UUID: %v", err)
+	}
+}
+
+func TestVerifyData(t *testing.T) {
+	fs := &FileSystem{superblock: &ondisk.Superblock{SectorSize: 4096, CsumType: ondisk.CsumTypeCRC32C}}
+
+	buf := make([]byte, 3*4096)
+	for i := range buf {
+		buf[i] = byte(i * 7)
+	}
+	sum, _ := ondisk.Checksum(ondisk.CsumTypeCRC32C, buf[4096:8192])
+	// Only the middle sector has a checksum.
+	csums := [][]byte{nil, sum[:4], nil}
+
+	if err := fs.verifyData(0x100000, buf, csums); err != nil {
+		t.Fatalf("verifyData rejected good data: %v", err)
+	}
+
+	buf[100] ^= 0xff
+	if err := fs.verifyData(0x100000, buf, csums); err != nil {
+		t.Errorf("a sector without a checksum was verified: %v", err)
+	}
+
+	buf[5000] ^= 0xff
+	err := fs.verifyData(0x100000, buf, csums)
+	if !errors.Is(err, errors.ErrInvalidChecksum) {
+		t.Fatalf("expected ErrInvalidChecksum, got %v", err)
+	}
+}
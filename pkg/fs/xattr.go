@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/WinBeyond/btrfs-read/pkg/btree"
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+// Xattr is an extended attribute.
+type Xattr struct {
+	Name  string `json:"name"`
+	Value []byte `json:"value"`
+}
+
+// ListXattrs returns the extended attributes of a file in on-disk (name
+// hash) order. Symlinks in the path are followed.
+func (fs *FileSystem) ListXattrs(path string) ([]Xattr, error) {
+	sub, ino, err := fs.lookupPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return sub.listXattrsInode(ino)
+}
+
+// GetXattr returns the value of one extended attribute of a file.
+// It returns ErrXattrNotFound if the file has no attribute with that name.
+func (fs *FileSystem) GetXattr(path string, name string) ([]byte, error) {
+	sub, ino, err := fs.lookupPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return sub.getXattrInode(ino, name)
+}
+
+// listXattrsInode walks every XATTR_ITEM of an inode.
+func (fs *FileSystem) listXattrsInode(ino uint64) ([]Xattr, error) {
+	minKey := &btree.Key{ObjectID: ino, Type: ondisk.KeyTypeXattrItem, Offset: 0}
+	maxKey := &btree.Key{ObjectID: ino, Type: ondisk.KeyTypeXattrItem, Offset: math.MaxUint64}
+
+	xattrs := make([]Xattr, 0)
+	err := fs.btreeSearcher.ScanRange(fs.fsTreeRoot, minKey, maxKey, func(item *btree.Item) (bool, error) {
+		entries, err := parseDirItems(item.Data)
+		if err != nil {
+			return false, fmt.Errorf("inode %d XATTR_ITEM %d: %w", ino, item.Key.Offset, err)
+		}
+		for _, entry := range entries {
+			xattrs = append(xattrs, Xattr{
+				Name:  string(entry.name),
+				Value: bytes.Clone(entry.data),
+			})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return xattrs, nil
+}
+
+// getXattrInode looks up one attribute by the hash of its name and then
+// compares names, since colliding names share an XATTR_ITEM.
+func (fs *FileSystem) getXattrInode(ino uint64, name string) ([]byte, error) {
+	key := &btree.Key{
+		ObjectID: ino,
+		Type:     ondisk.KeyTypeXattrItem,
+		Offset:   crc32Hash([]byte(name)),
+	}
+
+	path, err := fs.btreeSearcher.Search(fs.fsTreeRoot, key)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := path.GetItem()
+	if err != nil || item.Key.Compare(key) != 0 {
+		return nil, fmt.Errorf("%w: %s", errors.ErrXattrNotFound, name)
+	}
+
+	entries, err := parseDirItems(item.Data)
+	if err != nil {
+		return nil, fmt.Errorf("inode %d XATTR_ITEM %d: %w", ino, item.Key.Offset, err)
+	}
+	for _, entry := range entries {
+		if string(entry.name) == name {
+			return bytes.Clone(entry.data), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", errors.ErrXattrNotFound, name)
+}
@@ -26,6 +26,7 @@ const (
 const (
 	KeyTypeInodeItem       uint8 = 1
 	KeyTypeInodeRef        uint8 = 12
+	KeyTypeInodeExtref     uint8 = 13
 	KeyTypeDirLog          uint8 = 60
 	KeyTypeDirLogIndex     uint8 = 72
 	KeyTypeXattrItem       uint8 = 24
@@ -36,6 +37,7 @@ const (
 	KeyTypeRootRef         uint8 = 156
 	KeyTypeExtentItem      uint8 = 168
 	KeyTypeMetadataItem    uint8 = 169
+	KeyTypeExtentOwnerRef  uint8 = 172
 	KeyTypeTreeBlockRef    uint8 = 176
 	KeyTypeExtentDataRef   uint8 = 178
 	KeyTypeExtentRefV0     uint8 = 180
@@ -48,6 +50,7 @@ const (
 	KeyTypeDevExtent       uint8 = 204
 	KeyTypeDevItem         uint8 = 216
 	KeyTypeChunkItem       uint8 = 228
+	KeyTypePersistentItem  uint8 = 249 // Device statistics, keyed (DEV_STATS_OBJECTID, 249, devid)
 	KeyTypeDirItem         uint8 = 84
 	KeyTypeDirIndex        uint8 = 96
 )
@@ -65,6 +68,7 @@ const (
 	UUIDTreeObjectid      uint64 = 9
 	FreeSpaceTreeObjectid uint64 = 10
 	DevStatsObjectid      uint64 = 0
+	DevItemsObjectid      uint64 = 1                  // Objectid of DEV_ITEMs in the chunk tree
 	BalanceObjectid       uint64 = 0xFFFFFFFFFFFFFFF4 // -4 in uint64
 	OrphanObjectid        uint64 = 0xFFFFFFFFFFFFFFFB // -5
 	TreeLogObjectid       uint64 = 0xFFFFFFFFFFFFFFFA // -6
@@ -93,6 +97,18 @@ const (
 	FtMax     uint8 = 9
 )
 
+// Inode mode file type bits (st_mode & ModeTypeMask).
+const (
+	ModeTypeMask uint32 = 0170000
+	ModeSocket   uint32 = 0140000
+	ModeSymlink  uint32 = 0120000
+	ModeRegular  uint32 = 0100000
+	ModeBlockDev uint32 = 0060000
+	ModeDir      uint32 = 0040000
+	ModeCharDev  uint32 = 0020000
+	ModeFifo     uint32 = 0010000
+)
+
 // File extent types.
 const (
 	FileExtentInline   uint8 = 0
@@ -117,6 +133,51 @@ const (
 	CsumTypeBlake2 uint16 = 3
 )
 
+// Superblock flags (Superblock.Flags).
+const (
+	SuperFlagWritten          uint64 = 1 << 0
+	SuperFlagReloc            uint64 = 1 << 1
+	SuperFlagError            uint64 = 1 << 2
+	SuperFlagSeeding          uint64 = 1 << 32
+	SuperFlagMetadump         uint64 = 1 << 33
+	SuperFlagMetadumpV2       uint64 = 1 << 34
+	SuperFlagChangingFSID     uint64 = 1 << 35
+	SuperFlagChangingFSIDV2   uint64 = 1 << 36
+	SuperFlagChangingBGTree   uint64 = 1 << 38
+	SuperFlagChangingDataCsum uint64 = 1 << 39
+	SuperFlagChangingMetaCsum uint64 = 1 << 40
+)
+
+// Read-only compatible feature flags (Superblock.CompatRoFlags).
+const (
+	CompatRoFreeSpaceTree      uint64 = 1 << 0
+	CompatRoFreeSpaceTreeValid uint64 = 1 << 1
+	CompatRoVerity             uint64 = 1 << 2
+	CompatRoBlockGroupTree     uint64 = 1 << 3
+)
+
+// Incompatible feature flags (Superblock.IncompatFlags).
+const (
+	IncompatMixedBackref  uint64 = 1 << 0
+	IncompatDefaultSubvol uint64 = 1 << 1
+	IncompatMixedGroups   uint64 = 1 << 2
+	IncompatCompressLZO   uint64 = 1 << 3
+	IncompatCompressZstd  uint64 = 1 << 4
+	IncompatBigMetadata   uint64 = 1 << 5
+	IncompatExtendedIref  uint64 = 1 << 6
+	IncompatRaid56        uint64 = 1 << 7
+	IncompatSkinnyMeta    uint64 = 1 << 8
+	IncompatNoHoles       uint64 = 1 << 9
+	// IncompatMetadataUUID means tree blocks carry Superblock.MetadataUUID
+	// instead of the FSID, which was changed without rewriting metadata.
+	IncompatMetadataUUID   uint64 = 1 << 10
+	IncompatRaid1C34       uint64 = 1 << 11
+	IncompatZoned          uint64 = 1 << 12
+	IncompatExtentTreeV2   uint64 = 1 << 13
+	IncompatRaidStripeTree uint64 = 1 << 14
+	IncompatSimpleQuota    uint64 = 1 << 16
+)
+
 // RAID type flags.
 const (
 	BlockGroupData     uint64 = 1 << 0
@@ -130,6 +191,10 @@ const (
 	BlockGroupRaid6    uint64 = 1 << 8
 	BlockGroupRaid1C3  uint64 = 1 << 9
 	BlockGroupRaid1C4  uint64 = 1 << 10
+
+	// BlockGroupProfileMask selects the RAID profile bits; none set means SINGLE.
+	BlockGroupProfileMask = BlockGroupRaid0 | BlockGroupRaid1 | BlockGroupDup | BlockGroupRaid10 |
+		BlockGroupRaid5 | BlockGroupRaid6 | BlockGroupRaid1C3 | BlockGroupRaid1C4
 )
 
 // Inode flags.
@@ -0,0 +1,82 @@
+package ondisk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// CsumSize returns the number of checksum bytes a checksum type stores in
+// the ChecksumSize-byte csum field, or 0 for an unknown type.
+func CsumSize(csumType uint16) int {
+	switch csumType {
+	case CsumTypeCRC32C:
+		return 4
+	case CsumTypeXXHash:
+		return 8
+	case CsumTypeSHA256, CsumTypeBlake2:
+		return 32
+	}
+	return 0
+}
+
+// CsumName returns the name btrfs-progs uses for a checksum type.
+func CsumName(csumType uint16) string {
+	switch csumType {
+	case CsumTypeCRC32C:
+		return "crc32c"
+	case CsumTypeXXHash:
+		return "xxhash64"
+	case CsumTypeSHA256:
+		return "sha256"
+	case CsumTypeBlake2:
+		return "blake2b"
+	}
+	return fmt.Sprintf("unknown(%d)", csumType)
+}
+
+// Checksum computes the checksum of data as stored on disk: the digest in
+// little-endian byte order, zero-padded to ChecksumSize bytes.
+func Checksum(csumType uint16, data []byte) ([ChecksumSize]byte, error) {
+	var sum [ChecksumSize]byte
+
+	switch csumType {
+	case CsumTypeCRC32C:
+		binary.LittleEndian.PutUint32(sum[:], crc32.Checksum(data, castagnoli))
+	case CsumTypeXXHash:
+		binary.LittleEndian.PutUint64(sum[:], xxhash.Sum64(data))
+	case CsumTypeSHA256:
+		sum = sha256.Sum256(data)
+	case CsumTypeBlake2:
+		sum = blake2b.Sum256(data)
+	default:
+		return sum, fmt.Errorf("unsupported checksum type %d", csumType)
+	}
+
+	return sum, nil
+}
+
+// VerifyChecksum checks a metadata block (a tree node or a superblock),
+// whose first ChecksumSize bytes hold the checksum of the rest.
+func VerifyChecksum(csumType uint16, block []byte) error {
+	if len(block) <= ChecksumSize {
+		return fmt.Errorf("block too short for a checksum: %d bytes", len(block))
+	}
+
+	sum, err := Checksum(csumType, block[ChecksumSize:])
+	if err != nil {
+		return err
+	}
+
+	n := CsumSize(csumType)
+	if string(sum[:n]) != string(block[:n]) {
+		return fmt.Errorf("%s mismatch: stored %x, computed %x", CsumName(csumType), block[:n], sum[:n])
+	}
+	return nil
+}
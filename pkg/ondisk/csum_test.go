@@ -0,0 +1,51 @@
+package ondisk
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestChecksumKnownValues(t *testing.T) {
+	data := []byte("123456789")
+	for _, tc := range []struct {
+		csumType uint16
+		want     string
+	}{
+		{CsumTypeCRC32C, "839206e3"},         // 0xe3069283, little endian
+		{CsumTypeXXHash, "83aee640db41b88c"}, // 0x8cb841db40e6ae83
+		{CsumTypeSHA256, "15e2b0d3c33891ebb0f1ef609ec419420c20e320ce94c65fbc8c3312448eb225"},
+		{CsumTypeBlake2, "16e0bf1f85594a11e75030981c0b670370b3ad83a43f49ae58a2fd6f6513cde9"},
+	} {
+		sum, err := Checksum(tc.csumType, data)
+		if err != nil {
+			t.Fatalf("Checksum(%s) failed: %v", CsumName(tc.csumType), err)
+		}
+		if got := hex.EncodeToString(sum[:CsumSize(tc.csumType)]); got != tc.want {
+			t.Errorf("Checksum(%s) = %s, want %s", CsumName(tc.csumType), got, tc.want)
+		}
+	}
+
+	if _, err := Checksum(7, data); err == nil {
+		t.Error("Expected error for an unknown checksum type")
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	for _, csumType := range []uint16{CsumTypeCRC32C, CsumTypeXXHash, CsumTypeSHA256, CsumTypeBlake2} {
+		block := make([]byte, 4096)
+		for i := ChecksumSize; i < len(block); i++ {
+			block[i] = byte(i * 7)
+		}
+		sum, _ := Checksum(csumType, block[ChecksumSize:])
+		copy(block, sum[:])
+
+		if err := VerifyChecksum(csumType, block); err != nil {
+			t.Errorf("VerifyChecksum(%s) failed: %v", CsumName(csumType), err)
+		}
+
+		block[100] ^= 1
+		if err := VerifyChecksum(csumType, block); err == nil {
+			t.Errorf("VerifyChecksum(%s) accepted a corrupted block", CsumName(csumType))
+		}
+	}
+}
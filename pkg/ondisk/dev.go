@@ -0,0 +1,71 @@
+package ondisk
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DevExtentSize is the size of btrfs_dev_extent.
+const DevExtentSize = 48
+
+// DevExtent represents btrfs_dev_extent, the body of a DEV_EXTENT item
+// (devid, DEV_EXTENT, physical) in the dev tree: a range of a device
+// allocated to one stripe of a chunk.
+type DevExtent struct {
+	ChunkTree     uint64 // Tree holding the chunk, always the chunk tree
+	ChunkObjectid uint64 // Always FIRST_CHUNK_TREE_OBJECTID (256)
+	ChunkOffset   uint64 // Logical address of the chunk
+	Length        uint64 // Length of the range on the device
+	ChunkTreeUUID UUID
+}
+
+// Unmarshal parses a DevExtent from a byte slice.
+func (de *DevExtent) Unmarshal(data []byte) error {
+	if len(data) < DevExtentSize {
+		return fmt.Errorf("dev extent too short: got %d, need %d", len(data), DevExtentSize)
+	}
+
+	le := binary.LittleEndian
+	de.ChunkTree = le.Uint64(data[0:8])
+	de.ChunkObjectid = le.Uint64(data[8:16])
+	de.ChunkOffset = le.Uint64(data[16:24])
+	de.Length = le.Uint64(data[24:32])
+	copy(de.ChunkTreeUUID[:], data[32:48])
+
+	return nil
+}
+
+// Device statistics, the indexes of btrfs_dev_stats_item.values.
+const (
+	DevStatWriteErrs      = iota // EIO or EREMOTEIO from lower layers on write
+	DevStatReadErrs              // EIO or EREMOTEIO from lower layers on read
+	DevStatFlushErrs             // EIO or EREMOTEIO from lower layers on flush
+	DevStatCorruptionErrs        // Checksum errors, bytenr errors and the like
+	DevStatGenerationErrs        // Blocks with an unexpected generation
+	DevStatValuesMax
+)
+
+// DevStatsItem represents btrfs_dev_stats_item, the body of the persistent
+// item (DEV_STATS_OBJECTID, PERSISTENT_ITEM, devid) in the dev tree.
+type DevStatsItem struct {
+	Values [DevStatValuesMax]uint64
+}
+
+// Unmarshal parses a DevStatsItem from a byte slice. Items written by
+// kernels that knew fewer counters are shorter; the missing counters are
+// zero.
+func (ds *DevStatsItem) Unmarshal(data []byte) error {
+	if len(data)%8 != 0 {
+		return fmt.Errorf("dev stats item has odd size %d", len(data))
+	}
+
+	*ds = DevStatsItem{}
+	for i := range ds.Values {
+		if (i+1)*8 > len(data) {
+			break
+		}
+		ds.Values[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package ondisk
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestDevExtentUnmarshal(t *testing.T) {
+	buf := make([]byte, DevExtentSize)
+	le := binary.LittleEndian
+	le.PutUint64(buf[0:], ChunkTreeObjectid)
+	le.PutUint64(buf[8:], 256)
+	le.PutUint64(buf[16:], 0x1500000) // chunk_offset
+	le.PutUint64(buf[24:], 8<<20)     // length
+	buf[32] = 0xab
+
+	var de DevExtent
+	if err := de.Unmarshal(buf); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if de.ChunkTree != ChunkTreeObjectid || de.ChunkObjectid != 256 || de.ChunkOffset != 0x1500000 ||
+		de.Length != 8<<20 || de.ChunkTreeUUID[0] != 0xab {
+		t.Errorf("parsed %+v", de)
+	}
+	if err := de.Unmarshal(buf[:40]); err == nil {
+		t.Error("truncated dev extent should fail")
+	}
+}
+
+func TestDevStatsItemUnmarshal(t *testing.T) {
+	// An item from a kernel that knew only the first three counters.
+	buf := make([]byte, 3*8)
+	for i := 0; i < 3; i++ {
+		binary.LittleEndian.PutUint64(buf[i*8:], uint64(i+1))
+	}
+
+	var ds DevStatsItem
+	if err := ds.Unmarshal(buf); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	want := [DevStatValuesMax]uint64{1, 2, 3, 0, 0}
+	if ds.Values != want {
+		t.Errorf("Values = %v, want %v", ds.Values, want)
+	}
+	if err := ds.Unmarshal(buf[:5]); err == nil {
+		t.Error("odd-sized item should fail")
+	}
+}
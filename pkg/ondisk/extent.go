@@ -0,0 +1,179 @@
+package ondisk
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Sizes of the extent tree structures.
+const (
+	ExtentItemSize    = 24 // btrfs_extent_item
+	TreeBlockInfoSize = 18 // btrfs_tree_block_info: key (17) + level (1)
+	ExtentDataRefSize = 28 // btrfs_extent_data_ref
+	SharedDataRefSize = 4  // btrfs_shared_data_ref
+)
+
+// Extent item flags.
+const (
+	ExtentFlagData        uint64 = 1 << 0
+	ExtentFlagTreeBlock   uint64 = 1 << 1
+	ExtentFlagFullBackref uint64 = 1 << 8 // Tree block referenced by parent only
+)
+
+// ExtentItem represents btrfs_extent_item, the body of an EXTENT_ITEM
+// (bytenr, EXTENT_ITEM, length) or skinny METADATA_ITEM (bytenr,
+// METADATA_ITEM, level) of the extent tree, with the back references stored
+// inline after it. Further references are separate keyed items following
+// it.
+type ExtentItem struct {
+	Refs       uint64 // References to the extent
+	Generation uint64
+	Flags      uint64
+	Level      uint8 // Level of a tree block, from tree_block_info or the key
+	InlineRefs []ExtentRef
+}
+
+// ExtentRef is a back reference of an extent, either inline in its
+// ExtentItem or a keyed item. Which fields are set depends on Type:
+//
+//   - TREE_BLOCK_REF, EXTENT_OWNER_REF: Root is the tree owning the block
+//     or data.
+//   - SHARED_BLOCK_REF: Parent is the tree block pointing to the block.
+//   - EXTENT_DATA_REF: Root, Objectid and Offset name the file extent
+//     items of an inode, Count how many there are.
+//   - SHARED_DATA_REF: Parent is the leaf holding the file extent items,
+//     Count how many there are.
+type ExtentRef struct {
+	Type     uint8
+	Root     uint64
+	Parent   uint64
+	Objectid uint64 // Inode number
+	Offset   uint64 // File offset minus the offset into the extent
+	Count    uint32
+}
+
+// Unmarshal parses an ExtentItem and its inline references from the body
+// of an item of type keyType. keyOffset is the key offset, which holds the
+// level of a METADATA_ITEM.
+func (ei *ExtentItem) Unmarshal(data []byte, keyType uint8, keyOffset uint64) error {
+	if len(data) < ExtentItemSize {
+		// Items of version 0 filesystems only hold a reference count.
+		return fmt.Errorf("extent item too short: got %d, need %d", len(data), ExtentItemSize)
+	}
+
+	le := binary.LittleEndian
+	ei.Refs = le.Uint64(data[0:8])
+	ei.Generation = le.Uint64(data[8:16])
+	ei.Flags = le.Uint64(data[16:24])
+	off := ExtentItemSize
+
+	switch {
+	case keyType == KeyTypeMetadataItem:
+		ei.Level = uint8(keyOffset)
+	case ei.Flags&ExtentFlagTreeBlock != 0:
+		if len(data) < off+TreeBlockInfoSize {
+			return fmt.Errorf("extent item too short for tree block info: %d bytes", len(data))
+		}
+		ei.Level = data[off+17]
+		off += TreeBlockInfoSize
+	}
+
+	ei.InlineRefs = nil
+	for off < len(data) {
+		var ref ExtentRef
+		n, err := ref.unmarshalInline(data[off:])
+		if err != nil {
+			return fmt.Errorf("inline ref at offset %d: %w", off, err)
+		}
+		ei.InlineRefs = append(ei.InlineRefs, ref)
+		off += n
+	}
+
+	return nil
+}
+
+// unmarshalInline parses a btrfs_extent_inline_ref, a type byte followed by
+// the reference, and returns its size.
+func (r *ExtentRef) unmarshalInline(data []byte) (int, error) {
+	r.Type = data[0]
+	body := data[1:]
+
+	size := 8
+	switch r.Type {
+	case KeyTypeExtentDataRef:
+		size = ExtentDataRefSize
+	case KeyTypeSharedDataRef:
+		size = 8 + SharedDataRefSize
+	case KeyTypeTreeBlockRef, KeyTypeSharedBlockRef, KeyTypeExtentOwnerRef:
+	default:
+		return 0, fmt.Errorf("unknown inline ref type %d", r.Type)
+	}
+	if len(body) < size {
+		return 0, fmt.Errorf("inline ref type %d too short: got %d, need %d", r.Type, len(body), size)
+	}
+
+	le := binary.LittleEndian
+	switch r.Type {
+	case KeyTypeExtentDataRef:
+		r.unmarshalDataRef(body)
+	case KeyTypeSharedDataRef:
+		r.Parent = le.Uint64(body[0:8])
+		r.Count = le.Uint32(body[8:12])
+	case KeyTypeSharedBlockRef:
+		r.Parent = le.Uint64(body[0:8])
+	default:
+		r.Root = le.Uint64(body[0:8])
+	}
+
+	return 1 + size, nil
+}
+
+// Unmarshal parses a keyed back reference item (bytenr, keyType,
+// keyOffset) following an ExtentItem. The key offset is the root of a
+// TREE_BLOCK_REF and the parent of a SHARED_BLOCK_REF or SHARED_DATA_REF;
+// an EXTENT_DATA_REF is keyed by a hash of its body.
+func (r *ExtentRef) Unmarshal(data []byte, keyType uint8, keyOffset uint64) error {
+	*r = ExtentRef{Type: keyType}
+
+	le := binary.LittleEndian
+	switch keyType {
+	case KeyTypeTreeBlockRef:
+		r.Root = keyOffset
+	case KeyTypeSharedBlockRef:
+		r.Parent = keyOffset
+	case KeyTypeExtentDataRef:
+		if len(data) < ExtentDataRefSize {
+			return fmt.Errorf("extent data ref too short: got %d, need %d", len(data), ExtentDataRefSize)
+		}
+		r.unmarshalDataRef(data)
+	case KeyTypeSharedDataRef:
+		if len(data) < SharedDataRefSize {
+			return fmt.Errorf("shared data ref too short: got %d, need %d", len(data), SharedDataRefSize)
+		}
+		r.Parent = keyOffset
+		r.Count = le.Uint32(data[0:4])
+	default:
+		return fmt.Errorf("item type %d is not a back reference", keyType)
+	}
+
+	return nil
+}
+
+// unmarshalDataRef parses a btrfs_extent_data_ref.
+func (r *ExtentRef) unmarshalDataRef(data []byte) {
+	le := binary.LittleEndian
+	r.Root = le.Uint64(data[0:8])
+	r.Objectid = le.Uint64(data[8:16])
+	r.Offset = le.Uint64(data[16:24])
+	r.Count = le.Uint32(data[24:28])
+}
+
+// IsBackref reports whether an item type of the extent tree is a keyed
+// back reference.
+func IsBackref(keyType uint8) bool {
+	switch keyType {
+	case KeyTypeTreeBlockRef, KeyTypeSharedBlockRef, KeyTypeExtentDataRef, KeyTypeSharedDataRef:
+		return true
+	}
+	return false
+}
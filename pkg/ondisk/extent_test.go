@@ -0,0 +1,110 @@
+package ondisk
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestExtentItemUnmarshal(t *testing.T) {
+	le := binary.LittleEndian
+
+	// A data extent with an owner ref, an EXTENT_DATA_REF and a
+	// SHARED_DATA_REF inline.
+	buf := make([]byte, ExtentItemSize, 128)
+	le.PutUint64(buf[0:], 3)
+	le.PutUint64(buf[8:], 42)
+	le.PutUint64(buf[16:], ExtentFlagData)
+	buf = append(buf, KeyTypeExtentOwnerRef)
+	buf = le.AppendUint64(buf, 5)
+	buf = append(buf, KeyTypeExtentDataRef)
+	buf = le.AppendUint64(buf, 256)
+	buf = le.AppendUint64(buf, 257)
+	buf = le.AppendUint64(buf, 4096)
+	buf = le.AppendUint32(buf, 2)
+	buf = append(buf, KeyTypeSharedDataRef)
+	buf = le.AppendUint64(buf, 0x1c000)
+	buf = le.AppendUint32(buf, 1)
+
+	var ei ExtentItem
+	if err := ei.Unmarshal(buf, KeyTypeExtentItem, 8192); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if ei.Refs != 3 || ei.Generation != 42 || ei.Flags != ExtentFlagData {
+		t.Errorf("parsed %+v", ei)
+	}
+	want := []ExtentRef{
+		{Type: KeyTypeExtentOwnerRef, Root: 5},
+		{Type: KeyTypeExtentDataRef, Root: 256, Objectid: 257, Offset: 4096, Count: 2},
+		{Type: KeyTypeSharedDataRef, Parent: 0x1c000, Count: 1},
+	}
+	if !reflect.DeepEqual(ei.InlineRefs, want) {
+		t.Errorf("InlineRefs = %+v, want %+v", ei.InlineRefs, want)
+	}
+	if err := ei.Unmarshal(buf[:len(buf)-2], KeyTypeExtentItem, 8192); err == nil {
+		t.Error("truncated inline ref should fail")
+	}
+
+	// A non-skinny tree block carries tree_block_info before its refs.
+	tb := make([]byte, ExtentItemSize+TreeBlockInfoSize)
+	le.PutUint64(tb[0:], 1)
+	le.PutUint64(tb[16:], ExtentFlagTreeBlock)
+	tb[ExtentItemSize+17] = 1
+	tb = append(tb, KeyTypeSharedBlockRef)
+	tb = le.AppendUint64(tb, 0x30000)
+	if err := ei.Unmarshal(tb, KeyTypeExtentItem, 16384); err != nil {
+		t.Fatalf("Unmarshal tree block failed: %v", err)
+	}
+	if ei.Level != 1 || len(ei.InlineRefs) != 1 || ei.InlineRefs[0].Parent != 0x30000 {
+		t.Errorf("parsed tree block %+v", ei)
+	}
+
+	// A skinny METADATA_ITEM keeps its level in the key.
+	md := make([]byte, ExtentItemSize)
+	le.PutUint64(md[16:], ExtentFlagTreeBlock)
+	md = append(md, KeyTypeTreeBlockRef)
+	md = le.AppendUint64(md, 2)
+	if err := ei.Unmarshal(md, KeyTypeMetadataItem, 2); err != nil {
+		t.Fatalf("Unmarshal metadata item failed: %v", err)
+	}
+	if ei.Level != 2 || len(ei.InlineRefs) != 1 || ei.InlineRefs[0].Root != 2 {
+		t.Errorf("parsed metadata item %+v", ei)
+	}
+
+	if err := ei.Unmarshal(buf[:8], KeyTypeExtentItem, 4096); err == nil {
+		t.Error("version 0 extent item should fail")
+	}
+}
+
+func TestExtentRefUnmarshal(t *testing.T) {
+	le := binary.LittleEndian
+	body := le.AppendUint64(nil, 5)
+	body = le.AppendUint64(body, 260)
+	body = le.AppendUint64(body, 0)
+	body = le.AppendUint32(body, 1)
+
+	var r ExtentRef
+	if err := r.Unmarshal(body, KeyTypeExtentDataRef, 0x1234); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if r != (ExtentRef{Type: KeyTypeExtentDataRef, Root: 5, Objectid: 260, Count: 1}) {
+		t.Errorf("parsed %+v", r)
+	}
+
+	if err := r.Unmarshal(le.AppendUint32(nil, 3), KeyTypeSharedDataRef, 0x8000); err != nil {
+		t.Fatalf("Unmarshal shared data ref failed: %v", err)
+	}
+	if r != (ExtentRef{Type: KeyTypeSharedDataRef, Parent: 0x8000, Count: 3}) {
+		t.Errorf("parsed %+v", r)
+	}
+
+	if err := r.Unmarshal(nil, KeyTypeTreeBlockRef, 7); err != nil || r.Root != 7 {
+		t.Errorf("TREE_BLOCK_REF = %+v, %v", r, err)
+	}
+	if err := r.Unmarshal(body[:20], KeyTypeExtentDataRef, 0); err == nil {
+		t.Error("truncated extent data ref should fail")
+	}
+	if err := r.Unmarshal(nil, KeyTypeExtentItem, 0); err == nil {
+		t.Error("non-backref type should fail")
+	}
+}
@@ -0,0 +1,114 @@
+package ondisk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// flagName names one bit of a flag set.
+type flagName struct {
+	bit  uint64
+	name string
+}
+
+// Names follow /sys/fs/btrfs/<fsid>/features and btrfs-progs.
+var (
+	superFlagNames = []flagName{
+		{SuperFlagWritten, "written"},
+		{SuperFlagReloc, "reloc"},
+		{SuperFlagError, "error"},
+		{SuperFlagSeeding, "seeding"},
+		{SuperFlagMetadump, "metadump"},
+		{SuperFlagMetadumpV2, "metadump_v2"},
+		{SuperFlagChangingFSID, "changing_fsid"},
+		{SuperFlagChangingFSIDV2, "changing_fsid_v2"},
+		{SuperFlagChangingBGTree, "changing_bg_tree"},
+		{SuperFlagChangingDataCsum, "changing_data_csum"},
+		{SuperFlagChangingMetaCsum, "changing_meta_csum"},
+	}
+
+	compatRoFlagNames = []flagName{
+		{CompatRoFreeSpaceTree, "free_space_tree"},
+		{CompatRoFreeSpaceTreeValid, "free_space_tree_valid"},
+		{CompatRoVerity, "verity"},
+		{CompatRoBlockGroupTree, "block_group_tree"},
+	}
+
+	incompatFlagNames = []flagName{
+		{IncompatMixedBackref, "mixed_backref"},
+		{IncompatDefaultSubvol, "default_subvol"},
+		{IncompatMixedGroups, "mixed_groups"},
+		{IncompatCompressLZO, "compress_lzo"},
+		{IncompatCompressZstd, "compress_zstd"},
+		{IncompatBigMetadata, "big_metadata"},
+		{IncompatExtendedIref, "extended_iref"},
+		{IncompatRaid56, "raid56"},
+		{IncompatSkinnyMeta, "skinny_metadata"},
+		{IncompatNoHoles, "no_holes"},
+		{IncompatMetadataUUID, "metadata_uuid"},
+		{IncompatRaid1C34, "raid1c34"},
+		{IncompatZoned, "zoned"},
+		{IncompatExtentTreeV2, "extent_tree_v2"},
+		{IncompatRaidStripeTree, "raid_stripe_tree"},
+		{IncompatSimpleQuota, "simple_quota"},
+	}
+
+	blockGroupFlagNames = []flagName{
+		{BlockGroupData, "DATA"},
+		{BlockGroupSystem, "SYSTEM"},
+		{BlockGroupMetadata, "METADATA"},
+		{BlockGroupRaid0, "RAID0"},
+		{BlockGroupRaid1, "RAID1"},
+		{BlockGroupDup, "DUP"},
+		{BlockGroupRaid10, "RAID10"},
+		{BlockGroupRaid5, "RAID5"},
+		{BlockGroupRaid6, "RAID6"},
+		{BlockGroupRaid1C3, "RAID1C3"},
+		{BlockGroupRaid1C4, "RAID1C4"},
+	}
+)
+
+// formatFlags joins the names of the set bits with "|". Bits without a
+// name are shown together in hex, so no information is lost.
+func formatFlags(flags uint64, names []flagName) string {
+	var parts []string
+	for _, f := range names {
+		if flags&f.bit != 0 {
+			parts = append(parts, f.name)
+			flags &^= f.bit
+		}
+	}
+	if flags != 0 {
+		parts = append(parts, fmt.Sprintf("unknown(0x%x)", flags))
+	}
+	return strings.Join(parts, "|")
+}
+
+// FormatSuperFlags names the bits of Superblock.Flags.
+func FormatSuperFlags(flags uint64) string {
+	return formatFlags(flags, superFlagNames)
+}
+
+// FormatCompatRoFlags names the bits of Superblock.CompatRoFlags.
+func FormatCompatRoFlags(flags uint64) string {
+	return formatFlags(flags, compatRoFlagNames)
+}
+
+// FormatIncompatFlags names the bits of Superblock.IncompatFlags, e.g.
+// "mixed_backref|compress_zstd|skinny_metadata|no_holes".
+func FormatIncompatFlags(flags uint64) string {
+	return formatFlags(flags, incompatFlagNames)
+}
+
+// FormatCompatFlags names the bits of Superblock.CompatFlags. No compat
+// features are defined, so any set bit is unknown.
+func FormatCompatFlags(flags uint64) string {
+	return formatFlags(flags, nil)
+}
+
+// FormatBlockGroupType names the type and profile bits of a chunk or block
+// group, as btrfs inspect-internal dump-tree does, e.g. "DATA|RAID10". A
+// chunk without profile bits is SINGLE.
+func FormatBlockGroupType(flags uint64) string {
+	return formatFlags(flags, blockGroupFlagNames)
+}
@@ -0,0 +1,77 @@
+package ondisk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// InodeItemSize is the on-disk size of btrfs_inode_item.
+const InodeItemSize = 160
+
+// Timespec is a btrfs_timespec: seconds and nanoseconds since the epoch.
+type Timespec struct {
+	Sec  int64  `json:"sec"`
+	Nsec uint32 `json:"nsec"`
+}
+
+// Time converts the timestamp to a time.Time.
+func (ts Timespec) Time() time.Time {
+	return time.Unix(ts.Sec, int64(ts.Nsec))
+}
+
+// InodeItem represents btrfs_inode_item.
+type InodeItem struct {
+	Generation uint64   `json:"generation"`  // Generation the inode was created in
+	TransID    uint64   `json:"transid"`     // Last transaction that modified the inode
+	Size       uint64   `json:"size"`        // File size in bytes
+	NBytes     uint64   `json:"nbytes"`      // Bytes allocated on disk
+	BlockGroup uint64   `json:"block_group"` // Block group hint
+	NLink      uint32   `json:"nlink"`       // Hard link count
+	UID        uint32   `json:"uid"`         // Owner user ID
+	GID        uint32   `json:"gid"`         // Owner group ID
+	Mode       uint32   `json:"mode"`        // POSIX st_mode
+	RDev       uint64   `json:"rdev"`        // Device number for device files
+	Flags      uint64   `json:"flags"`       // Inode flags (Inode*)
+	Sequence   uint64   `json:"sequence"`    // NFS-compatible change counter
+	ATime      Timespec `json:"atime"`       // Last access
+	CTime      Timespec `json:"ctime"`       // Last inode change
+	MTime      Timespec `json:"mtime"`       // Last data modification
+	OTime      Timespec `json:"otime"`       // Creation (birth) time
+}
+
+// Unmarshal parses an InodeItem from a byte slice.
+func (ii *InodeItem) Unmarshal(data []byte) error {
+	if len(data) < InodeItemSize {
+		return fmt.Errorf("inode item too short: got %d, need %d", len(data), InodeItemSize)
+	}
+
+	le := binary.LittleEndian
+	ii.Generation = le.Uint64(data[0:8])
+	ii.TransID = le.Uint64(data[8:16])
+	ii.Size = le.Uint64(data[16:24])
+	ii.NBytes = le.Uint64(data[24:32])
+	ii.BlockGroup = le.Uint64(data[32:40])
+	ii.NLink = le.Uint32(data[40:44])
+	ii.UID = le.Uint32(data[44:48])
+	ii.GID = le.Uint32(data[48:52])
+	ii.Mode = le.Uint32(data[52:56])
+	ii.RDev = le.Uint64(data[56:64])
+	ii.Flags = le.Uint64(data[64:72])
+	ii.Sequence = le.Uint64(data[72:80])
+	// 80-112: reserved[4].
+	ii.ATime = unmarshalTimespec(data[112:124])
+	ii.CTime = unmarshalTimespec(data[124:136])
+	ii.MTime = unmarshalTimespec(data[136:148])
+	ii.OTime = unmarshalTimespec(data[148:160])
+
+	return nil
+}
+
+// unmarshalTimespec parses a 12-byte btrfs_timespec.
+func unmarshalTimespec(data []byte) Timespec {
+	return Timespec{
+		Sec:  int64(binary.LittleEndian.Uint64(data[0:8])),
+		Nsec: binary.LittleEndian.Uint32(data[8:12]),
+	}
+}
@@ -0,0 +1,69 @@
+package ondisk
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestInodeItemUnmarshal(t *testing.T) {
+	buf := make([]byte, InodeItemSize)
+	le := binary.LittleEndian
+	le.PutUint64(buf[0:], 7)        // generation
+	le.PutUint64(buf[8:], 9)        // transid
+	le.PutUint64(buf[16:], 12345)   // size
+	le.PutUint64(buf[24:], 16384)   // nbytes
+	le.PutUint32(buf[40:], 2)       // nlink
+	le.PutUint32(buf[44:], 1000)    // uid
+	le.PutUint32(buf[48:], 100)     // gid
+	le.PutUint32(buf[52:], 0100640) // mode
+	le.PutUint64(buf[56:], 0x0801)  // rdev
+	le.PutUint64(buf[64:], InodeNodatacow|InodeNoatime)
+	le.PutUint64(buf[72:], 3) // sequence
+	le.PutUint64(buf[112:], 1700000000)
+	le.PutUint32(buf[120:], 5)
+	le.PutUint64(buf[148:], 1600000000)
+	le.PutUint32(buf[156:], 999999999)
+
+	var ii InodeItem
+	if err := ii.Unmarshal(buf); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  uint64
+		want uint64
+	}{
+		{"Generation", ii.Generation, 7},
+		{"TransID", ii.TransID, 9},
+		{"Size", ii.Size, 12345},
+		{"NBytes", ii.NBytes, 16384},
+		{"NLink", uint64(ii.NLink), 2},
+		{"UID", uint64(ii.UID), 1000},
+		{"GID", uint64(ii.GID), 100},
+		{"Mode", uint64(ii.Mode), 0100640},
+		{"RDev", ii.RDev, 0x0801},
+		{"Flags", ii.Flags, InodeNodatacow | InodeNoatime},
+		{"Sequence", ii.Sequence, 3},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if got := ii.ATime.Time(); !got.Equal(time.Unix(1700000000, 5)) {
+		t.Errorf("ATime = %v", got)
+	}
+	if got := ii.OTime.Time(); !got.Equal(time.Unix(1600000000, 999999999)) {
+		t.Errorf("OTime = %v", got)
+	}
+}
+
+func TestInodeItemTooShort(t *testing.T) {
+	var ii InodeItem
+	if err := ii.Unmarshal(make([]byte, InodeItemSize-1)); err == nil {
+		t.Error("Expected error for short buffer, got nil")
+	}
+}
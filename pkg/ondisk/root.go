@@ -0,0 +1,155 @@
+package ondisk
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Root item sizes. Filesystems created before kernel 3.4 have the short
+// layout without generation_v2, UUIDs, transids and timestamps.
+const (
+	RootItemSize   = 439
+	RootItemSizeV0 = 239
+)
+
+// RootRefSize is the size of btrfs_root_ref without the trailing name.
+const RootRefSize = 18
+
+// UUID is a 16-byte btrfs UUID.
+type UUID [16]byte
+
+// IsZero reports whether the UUID is unset.
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+// String formats the UUID in canonical 8-4-4-4-12 form.
+func (u UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// ParseUUID parses a UUID in canonical form or as 32 hex digits.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != len(u) {
+		return u, fmt.Errorf("invalid UUID %q", s)
+	}
+	copy(u[:], b)
+	return u, nil
+}
+
+// MarshalText encodes the UUID in canonical form.
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// RootItem represents btrfs_root_item, the root tree entry describing one
+// tree: its root node and, for subvolumes, identity and snapshot metadata.
+type RootItem struct {
+	Inode        InodeItem `json:"inode"`         // Inode of the tree's root directory (unused)
+	Generation   uint64    `json:"generation"`    // Last transaction that modified the tree
+	RootDirID    uint64    `json:"root_dirid"`    // Objectid of the root directory
+	ByteNr       uint64    `json:"bytenr"`        // Logical address of the root node
+	ByteLimit    uint64    `json:"byte_limit"`    // Unused
+	BytesUsed    uint64    `json:"bytes_used"`    // Bytes used by the tree's nodes
+	LastSnapshot uint64    `json:"last_snapshot"` // Transaction of the last snapshot
+	Flags        uint64    `json:"flags"`         // Root flags (RootSubvolReadonly)
+	Refs         uint32    `json:"refs"`          // Reference count, 0 for deleted subvolumes
+	Level        uint8     `json:"level"`         // Level of the root node
+
+	// The fields below are valid only if GenerationV2 equals Generation;
+	// otherwise an old kernel has modified the item and they are zero.
+	GenerationV2 uint64   `json:"generation_v2"`
+	UUID         UUID     `json:"uuid"`          // UUID of the subvolume
+	ParentUUID   UUID     `json:"parent_uuid"`   // UUID of the snapshot source
+	ReceivedUUID UUID     `json:"received_uuid"` // UUID of the sent subvolume
+	CTransID     uint64   `json:"ctransid"`      // Transaction of the last change
+	OTransID     uint64   `json:"otransid"`      // Transaction of creation
+	STransID     uint64   `json:"stransid"`      // Send transaction
+	RTransID     uint64   `json:"rtransid"`      // Receive transaction
+	CTime        Timespec `json:"ctime"`         // Last change
+	OTime        Timespec `json:"otime"`         // Creation
+	STime        Timespec `json:"stime"`         // Send time
+	RTime        Timespec `json:"rtime"`         // Receive time
+}
+
+// Unmarshal parses a RootItem from a byte slice in either layout.
+func (ri *RootItem) Unmarshal(data []byte) error {
+	if len(data) < RootItemSizeV0 {
+		return fmt.Errorf("root item too short: got %d, need %d", len(data), RootItemSizeV0)
+	}
+
+	if err := ri.Inode.Unmarshal(data[0:InodeItemSize]); err != nil {
+		return err
+	}
+
+	le := binary.LittleEndian
+	ri.Generation = le.Uint64(data[160:168])
+	ri.RootDirID = le.Uint64(data[168:176])
+	ri.ByteNr = le.Uint64(data[176:184])
+	ri.ByteLimit = le.Uint64(data[184:192])
+	ri.BytesUsed = le.Uint64(data[192:200])
+	ri.LastSnapshot = le.Uint64(data[200:208])
+	ri.Flags = le.Uint64(data[208:216])
+	ri.Refs = le.Uint32(data[216:220])
+	// 220-237: drop_progress key, 237: drop_level.
+	ri.Level = data[238]
+
+	if len(data) < RootItemSize {
+		return nil
+	}
+
+	ri.GenerationV2 = le.Uint64(data[239:247])
+	if ri.GenerationV2 != ri.Generation {
+		return nil
+	}
+	copy(ri.UUID[:], data[247:263])
+	copy(ri.ParentUUID[:], data[263:279])
+	copy(ri.ReceivedUUID[:], data[279:295])
+	ri.CTransID = le.Uint64(data[295:303])
+	ri.OTransID = le.Uint64(data[303:311])
+	ri.STransID = le.Uint64(data[311:319])
+	ri.RTransID = le.Uint64(data[319:327])
+	ri.CTime = unmarshalTimespec(data[327:339])
+	ri.OTime = unmarshalTimespec(data[339:351])
+	ri.STime = unmarshalTimespec(data[351:363])
+	ri.RTime = unmarshalTimespec(data[363:375])
+	// 375-439: reserved[8].
+
+	return nil
+}
+
+// IsReadonly reports whether the subvolume is read-only.
+func (ri *RootItem) IsReadonly() bool {
+	return ri.Flags&RootSubvolReadonly != 0
+}
+
+// RootRef represents btrfs_root_ref, the body of both ROOT_REF
+// (parent, ROOT_REF, child) and ROOT_BACKREF (child, ROOT_BACKREF, parent)
+// items: where in the parent subvolume the child is linked.
+type RootRef struct {
+	DirID    uint64 // Directory inode in the parent holding the link
+	Sequence uint64 // DIR_INDEX offset of the link
+	Name     string // Name of the link
+}
+
+// Unmarshal parses a RootRef from a byte slice.
+func (rr *RootRef) Unmarshal(data []byte) error {
+	if len(data) < RootRefSize {
+		return fmt.Errorf("root ref too short: got %d, need %d", len(data), RootRefSize)
+	}
+
+	le := binary.LittleEndian
+	rr.DirID = le.Uint64(data[0:8])
+	rr.Sequence = le.Uint64(data[8:16])
+	nameLen := int(le.Uint16(data[16:18]))
+	if len(data) < RootRefSize+nameLen {
+		return fmt.Errorf("root ref name out of bounds: %d bytes", nameLen)
+	}
+	rr.Name = string(data[RootRefSize : RootRefSize+nameLen])
+
+	return nil
+}
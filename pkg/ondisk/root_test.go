@@ -0,0 +1,120 @@
+package ondisk
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestRootItemUnmarshal(t *testing.T) {
+	buf := make([]byte, RootItemSize)
+	le := binary.LittleEndian
+	le.PutUint32(buf[52:], 040755)     // inode mode
+	le.PutUint64(buf[160:], 42)        // generation
+	le.PutUint64(buf[168:], 256)       // root_dirid
+	le.PutUint64(buf[176:], 0x1d00000) // bytenr
+	le.PutUint64(buf[208:], RootSubvolReadonly)
+	le.PutUint32(buf[216:], 1)  // refs
+	buf[238] = 1                // level
+	le.PutUint64(buf[239:], 42) // generation_v2
+	for i := 0; i < 16; i++ {
+		buf[247+i] = byte(i)
+		buf[263+i] = byte(0x10 + i)
+	}
+	le.PutUint64(buf[303:], 40) // otransid
+	le.PutUint64(buf[339:], 1700000000)
+	le.PutUint32(buf[347:], 7)
+
+	var ri RootItem
+	if err := ri.Unmarshal(buf); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if ri.Inode.Mode != 040755 {
+		t.Errorf("Inode.Mode = %o, want 40755", ri.Inode.Mode)
+	}
+	if ri.Generation != 42 || ri.RootDirID != 256 || ri.ByteNr != 0x1d00000 {
+		t.Errorf("Generation/RootDirID/ByteNr = %d/%d/0x%x", ri.Generation, ri.RootDirID, ri.ByteNr)
+	}
+	if !ri.IsReadonly() {
+		t.Error("IsReadonly = false, want true")
+	}
+	if ri.Refs != 1 || ri.Level != 1 {
+		t.Errorf("Refs/Level = %d/%d, want 1/1", ri.Refs, ri.Level)
+	}
+	if got := ri.UUID.String(); got != "00010203-0405-0607-0809-0a0b0c0d0e0f" {
+		t.Errorf("UUID = %s", got)
+	}
+	if ri.ParentUUID[0] != 0x10 || !ri.ReceivedUUID.IsZero() {
+		t.Errorf("ParentUUID/ReceivedUUID = %s/%s", ri.ParentUUID, ri.ReceivedUUID)
+	}
+	if ri.OTransID != 40 || ri.OTime.Sec != 1700000000 || ri.OTime.Nsec != 7 {
+		t.Errorf("OTransID/OTime = %d/%+v", ri.OTransID, ri.OTime)
+	}
+}
+
+func TestRootItemUnmarshalV0(t *testing.T) {
+	buf := make([]byte, RootItemSize)
+	le := binary.LittleEndian
+	le.PutUint64(buf[160:], 42)
+	le.PutUint64(buf[176:], 0x4000)
+	le.PutUint64(buf[239:], 41) // stale generation_v2
+	buf[247] = 0xff
+
+	var ri RootItem
+	if err := ri.Unmarshal(buf); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if ri.ByteNr != 0x4000 {
+		t.Errorf("ByteNr = 0x%x, want 0x4000", ri.ByteNr)
+	}
+	if !ri.UUID.IsZero() {
+		t.Errorf("UUID = %s, want zero for a stale generation_v2", ri.UUID)
+	}
+
+	if err := ri.Unmarshal(buf[:RootItemSizeV0]); err != nil {
+		t.Errorf("Unmarshal of a v0 item failed: %v", err)
+	}
+	if err := ri.Unmarshal(buf[:RootItemSizeV0-1]); err == nil {
+		t.Error("Expected error for a truncated item")
+	}
+}
+
+func TestRootRefUnmarshal(t *testing.T) {
+	buf := make([]byte, RootRefSize+len("snap"))
+	binary.LittleEndian.PutUint64(buf[0:], 257)
+	binary.LittleEndian.PutUint64(buf[8:], 3)
+	binary.LittleEndian.PutUint16(buf[16:], 4)
+	copy(buf[18:], "snap")
+
+	var rr RootRef
+	if err := rr.Unmarshal(buf); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if rr.DirID != 257 || rr.Sequence != 3 || rr.Name != "snap" {
+		t.Errorf("RootRef = %+v", rr)
+	}
+
+	if err := rr.Unmarshal(buf[:RootRefSize+2]); err == nil {
+		t.Error("Expected error for a truncated name")
+	}
+}
+
+func TestParseUUID(t *testing.T) {
+	want := "00010203-0405-0607-0809-0a0b0c0d0e0f"
+	for _, s := range []string{want, "000102030405060708090A0B0C0D0E0F"} {
+		u, err := ParseUUID(s)
+		if err != nil {
+			t.Errorf("ParseUUID(%q) failed: %v", s, err)
+			continue
+		}
+		if u.String() != want {
+			t.Errorf("ParseUUID(%q) = %s, want %s", s, u, want)
+		}
+	}
+
+	for _, s := range []string{"", "0001", "zz010203-0405-0607-0809-0a0b0c0d0e0f"} {
+		if _, err := ParseUUID(s); err == nil {
+			t.Errorf("ParseUUID(%q) should fail", s)
+		}
+	}
+}
@@ -40,9 +40,52 @@ type Superblock struct {
 	CacheGeneration     uint64    // Cache generation
 	UUIDTreeGeneration  uint64    // UUID tree generation
 	MetadataUUID        [16]byte  // Metadata UUID
+	NrGlobalRoots       uint64    // Number of global roots (extent tree v2)
+
+	// Block group tree (CompatRoBlockGroupTree)
+	BlockGroupRoot           uint64 // Block group tree logical address
+	BlockGroupRootGeneration uint64 // Block group tree generation
+	BlockGroupRootLevel      uint8  // Block group tree level
 
 	// System chunk array (embedded chunk mapping)
 	SysChunkArray [2048]byte
+
+	// Backup copies of the tree roots from the last NumBackupRoots
+	// transactions, used as a ring buffer.
+	SuperRoots [NumBackupRoots]RootBackup
+}
+
+// Root backup layout.
+const (
+	NumBackupRoots   = 4
+	RootBackupSize   = 168
+	superRootsOffset = 2859 // After sys_chunk_array (811 + 2048)
+)
+
+// RootBackup represents btrfs_root_backup: the root of every core tree as of
+// one recent transaction.
+type RootBackup struct {
+	TreeRoot        uint64 // Root tree logical address
+	TreeRootGen     uint64 // Root tree generation
+	ChunkRoot       uint64 // Chunk tree logical address
+	ChunkRootGen    uint64 // Chunk tree generation
+	ExtentRoot      uint64 // Extent tree logical address
+	ExtentRootGen   uint64 // Extent tree generation
+	FSRoot          uint64 // Top-level FS tree logical address
+	FSRootGen       uint64 // FS tree generation
+	DevRoot         uint64 // Device tree logical address
+	DevRootGen      uint64 // Device tree generation
+	CsumRoot        uint64 // Checksum tree logical address
+	CsumRootGen     uint64 // Checksum tree generation
+	TotalBytes      uint64 // Total bytes at that transaction
+	BytesUsed       uint64 // Bytes used at that transaction
+	NumDevices      uint64 // Device count at that transaction
+	TreeRootLevel   uint8
+	ChunkRootLevel  uint8
+	ExtentRootLevel uint8
+	FSRootLevel     uint8
+	DevRootLevel    uint8
+	CsumRootLevel   uint8
 }
 
 // DevItem represents a device item.
@@ -181,11 +224,33 @@ func (sb *Superblock) Unmarshal(data []byte) error {
 		return err
 	}
 
-	// Jump from label directly to sys_chunk_array (offset 811).
 	// Label ends at offset 555 (32+16+8*10+4*4+4+8*4+2+3+98+256).
-	// sys_chunk_array starts at offset 811.
-	// Skip 256 bytes (811 - 555 = 256).
-	if _, err := r.Seek(256, 1); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &sb.CacheGeneration); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sb.UUIDTreeGeneration); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sb.MetadataUUID); err != nil {
+		return err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &sb.NrGlobalRoots); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sb.BlockGroupRoot); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sb.BlockGroupRootGeneration); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sb.BlockGroupRootLevel); err != nil {
+		return err
+	}
+
+	// Skip the reserved area; sys_chunk_array starts at offset 811
+	// (612 + 7 + 8*24).
+	if _, err := r.Seek(7+8*24, 1); err != nil {
 		return err
 	}
 
@@ -194,9 +259,56 @@ func (sb *Superblock) Unmarshal(data []byte) error {
 		return err
 	}
 
+	// Backup roots follow the system chunk array at offset 2859.
+	for i := range sb.SuperRoots {
+		off := superRootsOffset + i*RootBackupSize
+		if err := sb.SuperRoots[i].Unmarshal(data[off : off+RootBackupSize]); err != nil {
+			return fmt.Errorf("failed to read backup root %d: %w", i, err)
+		}
+	}
+
 	return nil
 }
 
+// Unmarshal parses a RootBackup from a byte slice.
+func (rb *RootBackup) Unmarshal(data []byte) error {
+	if len(data) < RootBackupSize {
+		return fmt.Errorf("root backup too short: got %d, need %d", len(data), RootBackupSize)
+	}
+
+	le := binary.LittleEndian
+	rb.TreeRoot = le.Uint64(data[0:8])
+	rb.TreeRootGen = le.Uint64(data[8:16])
+	rb.ChunkRoot = le.Uint64(data[16:24])
+	rb.ChunkRootGen = le.Uint64(data[24:32])
+	rb.ExtentRoot = le.Uint64(data[32:40])
+	rb.ExtentRootGen = le.Uint64(data[40:48])
+	rb.FSRoot = le.Uint64(data[48:56])
+	rb.FSRootGen = le.Uint64(data[56:64])
+	rb.DevRoot = le.Uint64(data[64:72])
+	rb.DevRootGen = le.Uint64(data[72:80])
+	rb.CsumRoot = le.Uint64(data[80:88])
+	rb.CsumRootGen = le.Uint64(data[88:96])
+	rb.TotalBytes = le.Uint64(data[96:104])
+	rb.BytesUsed = le.Uint64(data[104:112])
+	rb.NumDevices = le.Uint64(data[112:120])
+	// 120-152: unused_64[4].
+	rb.TreeRootLevel = data[152]
+	rb.ChunkRootLevel = data[153]
+	rb.ExtentRootLevel = data[154]
+	rb.FSRootLevel = data[155]
+	rb.DevRootLevel = data[156]
+	rb.CsumRootLevel = data[157]
+	// 158-168: unused_8[10].
+
+	return nil
+}
+
+// IsEmpty reports whether the backup slot has never been written.
+func (rb *RootBackup) IsEmpty() bool {
+	return rb.TreeRoot == 0
+}
+
 // Unmarshal parses a DevItem from a byte slice.
 func (di *DevItem) Unmarshal(data []byte) error {
 	r := bytes.NewReader(data)
@@ -257,6 +369,14 @@ func (sb *Superblock) GetLabel() string {
 	return string(sb.Label[:end])
 }
 
+// MetadataFSID returns the FSID stamped in the header of every tree block.
+func (sb *Superblock) MetadataFSID() [16]byte {
+	if sb.IncompatFlags&IncompatMetadataUUID != 0 {
+		return sb.MetadataUUID
+	}
+	return sb.FSID
+}
+
 // IsValid validates whether the superblock is valid.
 func (sb *Superblock) IsValid() bool {
 	return bytes.Equal(sb.Magic[:], BtrfsMagic[:])
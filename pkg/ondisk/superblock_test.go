@@ -181,6 +181,74 @@ func TestSuperblockFields(t *testing.T) {
 	}
 }
 
+func TestSuperblockTrailingFields(t *testing.T) {
+	buf := make([]byte, SuperblockSize)
+	le := binary.LittleEndian
+	copy(buf[64:], BtrfsMagic[:])
+	le.PutUint64(buf[555:], 41) // cache_generation
+	le.PutUint64(buf[563:], 42) // uuid_tree_generation
+	buf[571] = 0xaa             // metadata_uuid
+	le.PutUint64(buf[587:], 3)  // nr_global_roots
+	le.PutUint64(buf[595:], 0x5000000)
+	le.PutUint64(buf[603:], 40)
+	buf[611] = 1
+	buf[811] = 0xcc // sys_chunk_array
+
+	// Second backup root slot.
+	rb := buf[2859+RootBackupSize:]
+	le.PutUint64(rb[0:], 0x1c000)  // tree_root
+	le.PutUint64(rb[8:], 39)       // tree_root_gen
+	le.PutUint64(rb[16:], 0x14000) // chunk_root
+	le.PutUint64(rb[80:], 0x2c000) // csum_root
+	le.PutUint64(rb[112:], 2)      // num_devices
+	rb[152], rb[157] = 1, 2        // tree_root_level, csum_root_level
+
+	sb := &Superblock{}
+	if err := sb.Unmarshal(buf); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if sb.CacheGeneration != 41 || sb.UUIDTreeGeneration != 42 || sb.MetadataUUID[0] != 0xaa {
+		t.Errorf("CacheGeneration/UUIDTreeGeneration/MetadataUUID = %d/%d/%x",
+			sb.CacheGeneration, sb.UUIDTreeGeneration, sb.MetadataUUID)
+	}
+	if sb.NrGlobalRoots != 3 || sb.BlockGroupRoot != 0x5000000 || sb.BlockGroupRootGeneration != 40 || sb.BlockGroupRootLevel != 1 {
+		t.Errorf("NrGlobalRoots/BlockGroupRoot = %d/0x%x gen %d level %d",
+			sb.NrGlobalRoots, sb.BlockGroupRoot, sb.BlockGroupRootGeneration, sb.BlockGroupRootLevel)
+	}
+	if sb.SysChunkArray[0] != 0xcc {
+		t.Errorf("SysChunkArray[0] = 0x%x, want 0xcc", sb.SysChunkArray[0])
+	}
+
+	if !sb.SuperRoots[0].IsEmpty() {
+		t.Errorf("SuperRoots[0] = %+v, want empty", sb.SuperRoots[0])
+	}
+	got := sb.SuperRoots[1]
+	want := RootBackup{TreeRoot: 0x1c000, TreeRootGen: 39, ChunkRoot: 0x14000, CsumRoot: 0x2c000,
+		NumDevices: 2, TreeRootLevel: 1, CsumRootLevel: 2}
+	if got != want {
+		t.Errorf("SuperRoots[1] = %+v, want %+v", got, want)
+	}
+}
+
+func TestFormatFlags(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{FormatIncompatFlags(IncompatMixedBackref | IncompatCompressZstd | IncompatSkinnyMeta | IncompatNoHoles),
+			"mixed_backref|compress_zstd|skinny_metadata|no_holes"},
+		{FormatCompatRoFlags(CompatRoFreeSpaceTree | CompatRoFreeSpaceTreeValid), "free_space_tree|free_space_tree_valid"},
+		{FormatSuperFlags(SuperFlagSeeding | 1<<50), "seeding|unknown(0x4000000000000)"},
+		{FormatCompatFlags(0), ""},
+		{FormatBlockGroupType(BlockGroupMetadata | BlockGroupRaid1C3), "METADATA|RAID1C3"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}
+
 func BenchmarkSuperblockUnmarshal(b *testing.B) {
 	buf := make([]byte, SuperblockSize)
 	copy(buf[48:56], BtrfsMagic[:])
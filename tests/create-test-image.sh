@@ -25,10 +25,10 @@ fi
 
 # Check required tools
 echo -e "${YELLOW}检查必要工具...${NC}"
-for cmd in truncate mkfs.btrfs mount umount; do
+for cmd in truncate mkfs.btrfs btrfs mount umount setfattr setfacl; do
     if ! command -v $cmd &> /dev/null; then
         echo -e "${RED}错误: 未找到命令 '$cmd'${NC}"
-        echo "请安装 btrfs-progs: sudo apt install btrfs-progs"
+        echo "请安装 btrfs-progs, attr 和 acl: sudo apt install btrfs-progs attr acl"
         exit 1
     fi
 done
@@ -66,7 +66,9 @@ echo -e "${YELLOW}创建测试数据...${NC}"
 echo "Hello Btrfs!" > "$MOUNT_POINT/hello.txt"
 echo "This is a test file for Btrfs read service." > "$MOUNT_POINT/test.txt"
 
-# Create directory structure
+# Create directory structure; /home is a separate subvolume, as on
+# Fedora and openSUSE installs
+btrfs subvolume create "$MOUNT_POINT/home"
 mkdir -p "$MOUNT_POINT/home/user"
 mkdir -p "$MOUNT_POINT/etc"
 mkdir -p "$MOUNT_POINT/var/log"
@@ -81,8 +83,30 @@ dd if=/dev/urandom of="$MOUNT_POINT/small.bin" bs=1K count=1 2>/dev/null
 dd if=/dev/urandom of="$MOUNT_POINT/medium.bin" bs=1K count=64 2>/dev/null
 dd if=/dev/urandom of="$MOUNT_POINT/large.bin" bs=1K count=512 2>/dev/null
 
-# Create a symbolic link
+# Create a file made of several extents around a hole
+head -c 1M /dev/zero | tr '\0' 'A' > "$MOUNT_POINT/multi-extent.bin"
+sync
+head -c 1M /dev/zero | tr '\0' 'B' | dd of="$MOUNT_POINT/multi-extent.bin" bs=1M seek=2 conv=notrunc 2>/dev/null
+
+# Create compressed files (one per algorithm)
+for alg in zlib lzo zstd; do
+    touch "$MOUNT_POINT/compressed-$alg.txt"
+    btrfs property set "$MOUNT_POINT/compressed-$alg.txt" compression $alg
+    for i in $(seq 1 2000); do echo "line $i of a compressible $alg file"; done > "$MOUNT_POINT/compressed-$alg.txt"
+done
+
+# Extended attributes, including two names whose hashes collide so they
+# share one XATTR_ITEM, and POSIX ACLs
+setfattr -n user.comment -v "hello xattr" "$MOUNT_POINT/hello.txt"
+setfattr -n user.collide-1371838 -v first "$MOUNT_POINT/hello.txt"
+setfattr -n user.collide-2000402 -v second "$MOUNT_POINT/hello.txt"
+setfacl -m u:1000:r "$MOUNT_POINT/hello.txt"
+setfacl -d -m u:1000:rwx "$MOUNT_POINT/etc"
+
+# Create symbolic links (relative, to a directory and absolute)
 ln -s hello.txt "$MOUNT_POINT/link.txt"
+ln -s deep/nested "$MOUNT_POINT/nested-link"
+ln -s /home/user/data.txt "$MOUNT_POINT/abs-link.txt"
 
 # Create nested directories
 mkdir -p "$MOUNT_POINT/deep/nested/directory/structure"
@@ -92,6 +116,32 @@ echo "deep file" > "$MOUNT_POINT/deep/nested/directory/structure/file.txt"
 touch "$MOUNT_POINT/file with spaces.txt"
 echo "special" > "$MOUNT_POINT/file with spaces.txt"
 
+# A directory whose DIR_INDEX numbers are sparse and above 10000: create
+# 10500 files and delete the first 10000
+mkdir -p "$MOUNT_POINT/many"
+(cd "$MOUNT_POINT/many" && seq -f "file-%g" 1 10500 | xargs touch && seq -f "file-%g" 1 10000 | xargs rm)
+
+# File names whose hashes collide, so each pair shares one DIR_ITEM;
+# collide-2000403 is left out so its lookup hits collide-1371839's item
+mkdir -p "$MOUNT_POINT/collide"
+echo "first" > "$MOUNT_POINT/collide/collide-1371838"
+echo "second" > "$MOUNT_POINT/collide/collide-2000402"
+echo "third" > "$MOUNT_POINT/collide/collide-1371839"
+
+# Take a read-only snapshot of /home, then change the live copy
+mkdir -p "$MOUNT_POINT/snapshots"
+btrfs subvolume snapshot -r "$MOUNT_POINT/home" "$MOUNT_POINT/snapshots/home-snap"
+echo "new file" > "$MOUNT_POINT/home/user/new.txt"
+
+# Commit a few more transactions, so that the superblock backup roots
+# (info --full) hold older root sets to fall back to
+for i in 1 2 3 4; do
+    echo "transaction $i" > "$MOUNT_POINT/.transaction"
+    btrfs filesystem sync "$MOUNT_POINT"
+done
+rm -f "$MOUNT_POINT/.transaction"
+btrfs filesystem sync "$MOUNT_POINT"
+
 echo -e "${GREEN}✓ 测试数据创建成功${NC}"
 
 # 5. Show filesystem information
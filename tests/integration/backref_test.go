@@ -0,0 +1,58 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/fs"
+)
+
+func TestLogicalResolve(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	info, err := filesystem.Stat("/large.bin")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	extents, err := filesystem.DevExtents(1)
+	if err != nil {
+		t.Fatalf("DevExtents failed: %v", err)
+	}
+
+	// Probe the chunks for a block of /large.bin.
+	var logical uint64
+	var found *fs.LogicalInode
+	for _, e := range extents {
+		for off := uint64(0); off < e.Length && found == nil; off += 4096 {
+			inodes, err := filesystem.LogicalResolve(e.ChunkOffset + off)
+			if err != nil {
+				continue
+			}
+			for _, inode := range inodes {
+				if inode.Root == 5 && inode.Inode == info.Ino {
+					logical, found = e.ChunkOffset+off, inode
+				}
+			}
+		}
+	}
+	if found == nil {
+		t.Fatal("no logical address resolves to /large.bin")
+	}
+	t.Logf("logical 0x%x: %+v", logical, found)
+	if len(found.Paths) != 1 || found.Paths[0] != "/large.bin" {
+		t.Errorf("Paths = %v, want [/large.bin]", found.Paths)
+	}
+
+	// An address inside the block is the same file, further in.
+	inodes, err := filesystem.LogicalResolve(logical + 0x123)
+	if err != nil {
+		t.Fatalf("LogicalResolve(0x%x) failed: %v", logical+0x123, err)
+	}
+	if len(inodes) != 1 || inodes[0].Inode != info.Ino || inodes[0].Offset != found.Offset+0x123 {
+		t.Errorf("LogicalResolve(0x%x) = %+v, want inode %d offset %d", logical+0x123, inodes, info.Ino, found.Offset+0x123)
+	}
+
+	if _, err := filesystem.LogicalResolve(0x10000); !errors.Is(err, errors.ErrExtentNotFound) {
+		t.Errorf("LogicalResolve before the first chunk: err = %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+)
+
+func TestListDevices(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	devices, err := filesystem.ListDevices()
+	if err != nil {
+		t.Fatalf("ListDevices failed: %v", err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("got %d devices, want 1", len(devices))
+	}
+
+	d := devices[0]
+	t.Logf("device %d: %s, %d of %d bytes used", d.DevID, d.UUID, d.BytesUsed, d.TotalBytes)
+	if d.DevID != 1 || d.Missing || d.Path != testImagePath {
+		t.Errorf("device = %+v", d)
+	}
+	if d.UUID.IsZero() || d.TotalBytes == 0 || d.BytesUsed == 0 || d.BytesUsed > d.TotalBytes {
+		t.Errorf("device sizes or UUID wrong: %+v", d)
+	}
+	if d.Stats.Total() != 0 {
+		t.Errorf("fresh image has errors recorded: %+v", d.Stats)
+	}
+}
+
+func TestDevExtents(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	extents, err := filesystem.DevExtents(1)
+	if err != nil {
+		t.Fatalf("DevExtents failed: %v", err)
+	}
+	if len(extents) == 0 {
+		t.Fatal("no dev extents on device 1")
+	}
+
+	for i, e := range extents {
+		if i > 0 && e.Physical < extents[i-1].Physical+extents[i-1].Length {
+			t.Errorf("extent at 0x%x overlaps the previous one", e.Physical)
+		}
+
+		// Every byte of the extent maps back to it.
+		for _, physical := range []uint64{e.Physical, e.Physical + e.Length - 1} {
+			found, err := filesystem.FindDevExtent(1, physical)
+			if err != nil || *found != *e {
+				t.Errorf("FindDevExtent(1, 0x%x) = %+v, %v, want %+v", physical, found, err, e)
+			}
+		}
+	}
+
+	// The first megabyte holds the superblock, not chunks.
+	if _, err := filesystem.FindDevExtent(1, 0x10000); !errors.Is(err, errors.ErrChunkNotFound) {
+		t.Errorf("FindDevExtent of the superblock: err = %v", err)
+	}
+	if _, err := filesystem.FindDevExtent(2, extents[0].Physical); !errors.Is(err, errors.ErrChunkNotFound) {
+		t.Errorf("FindDevExtent on an unknown device: err = %v", err)
+	}
+}
+
+func TestPhysicalToLogical(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	extents, err := filesystem.DevExtents(1)
+	if err != nil {
+		t.Fatalf("DevExtents failed: %v", err)
+	}
+
+	for _, e := range extents {
+		addr, err := filesystem.PhysicalToLogical(1, e.Physical+0x1234)
+		if err != nil {
+			t.Errorf("PhysicalToLogical(1, 0x%x) failed: %v", e.Physical+0x1234, err)
+			continue
+		}
+		if addr.ChunkStart != e.ChunkOffset || addr.Parity != 0 {
+			t.Errorf("0x%x maps to %+v, want chunk 0x%x", e.Physical+0x1234, addr, e.ChunkOffset)
+		}
+		// The test image has no striped chunks: the offset into the dev
+		// extent is the offset into the chunk, on copy 1 or 2 (DUP).
+		if addr.Logical != e.ChunkOffset+0x1234 {
+			t.Errorf("0x%x maps to logical 0x%x, want 0x%x", e.Physical+0x1234, addr.Logical, e.ChunkOffset+0x1234)
+		}
+	}
+
+	if _, err := filesystem.PhysicalToLogical(1, 0x10000); !errors.Is(err, errors.ErrChunkNotFound) {
+		t.Errorf("PhysicalToLogical of the superblock: err = %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package integration
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	btrfs "github.com/WinBeyond/btrfs-read/pkg/fs"
+)
+
+func TestIOFS(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+	fsys := btrfs.NewIOFS(filesystem)
+
+	if err := fstest.TestFS(fsys,
+		"hello.txt",
+		"test.txt",
+		"home/user/data.txt",
+		"home/user/new.txt",
+		"snapshots/home-snap/user/data.txt",
+		"etc/config.conf",
+		"var/log/test.log",
+		"multi-extent.bin",
+		"deep/nested/directory/structure/file.txt",
+		"file with spaces.txt",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIOFSWalkDir(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+	fsys := btrfs.NewIOFS(filesystem)
+
+	var found []string
+	err := fs.WalkDir(fsys, "deep", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			found = append(found, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir failed: %v", err)
+	}
+	if len(found) != 1 || found[0] != "deep/nested/directory/structure/file.txt" {
+		t.Errorf("Unexpected files: %v", found)
+	}
+
+	matches, err := fs.Glob(fsys, "*/user/*.txt")
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0] != "home/user/data.txt" || matches[1] != "home/user/new.txt" {
+		t.Errorf("Unexpected Glob matches: %v", matches)
+	}
+}
+
+func TestIOFSSymlink(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+	fsys := btrfs.NewIOFS(filesystem)
+
+	target, err := fsys.ReadLink("link.txt")
+	if err != nil || target != "hello.txt" {
+		t.Fatalf("ReadLink = %q, %v, want %q", target, err, "hello.txt")
+	}
+
+	info, err := fsys.Lstat("link.txt")
+	if err != nil {
+		t.Fatalf("Lstat failed: %v", err)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Lstat mode = %v, want a symlink", info.Mode())
+	}
+
+	// Open and ReadFile follow the link.
+	data, err := fs.ReadFile(fsys, "link.txt")
+	if err != nil || string(data) != "Hello Btrfs!\n" {
+		t.Errorf("ReadFile through link = %q, %v", data, err)
+	}
+}
+
+func TestIOFSErrors(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+	fsys := btrfs.NewIOFS(filesystem)
+
+	if _, err := fsys.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+	if _, err := fsys.Open("/hello.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Expected fs.ErrInvalid for rooted name, got %v", err)
+	}
+	if _, err := fsys.Open("hello.txt/child"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Expected ENOTDIR below a file, got %v", err)
+	}
+	if _, err := fsys.Stat("missing-dir/x"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist below a missing name, got %v", err)
+	}
+	if _, err := fs.ReadFile(fsys, "hello.txt/child"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Expected ENOTDIR from ReadFile below a file, got %v", err)
+	}
+	if _, err := fs.ReadFile(fsys, "etc"); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("Expected EISDIR from ReadFile of a directory, got %v", err)
+	}
+	if _, err := fs.ReadDir(fsys, "hello.txt"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Expected ENOTDIR from ReadDir of a file, got %v", err)
+	}
+	if _, err := fs.Sub(fsys, "hello.txt"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Expected ENOTDIR from Sub of a file, got %v", err)
+	}
+
+	dir, err := fsys.Open("etc")
+	if err != nil {
+		t.Fatalf("Open(etc) failed: %v", err)
+	}
+	defer dir.Close()
+	if _, err := dir.Read(make([]byte, 1)); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("Expected EISDIR reading a directory, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package integration
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestListDirectory(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	entries, err := filesystem.ListDirectory("/var/log")
+	if err != nil {
+		t.Fatalf("ListDirectory failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "test.log" || entries[0].IsDir {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestListDirectorySparseIndex(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	// /many holds file-10001 .. file-10500; their DIR_INDEX numbers are all
+	// above 10000 because the first 10000 files were deleted.
+	entries, err := filesystem.ListDirectory("/many")
+	if err != nil {
+		t.Fatalf("ListDirectory failed: %v", err)
+	}
+
+	if len(entries) != 500 {
+		t.Fatalf("ListDirectory returned %d entries, want 500", len(entries))
+	}
+	for i, entry := range entries {
+		// Entries come back in index order, which is creation order.
+		if want := fmt.Sprintf("file-%d", 10001+i); entry.Name != want {
+			t.Fatalf("Entry %d is %q, want %q", i, entry.Name, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+)
+
+func TestLookupHashCollision(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	// collide-1371838 and collide-2000402 have the same name hash, so both
+	// entries are packed into a single DIR_ITEM.
+	for name, want := range map[string]string{
+		"collide-1371838": "first\n",
+		"collide-2000402": "second\n",
+		"collide-1371839": "third\n",
+	} {
+		data, err := filesystem.ReadFile("/collide/" + name)
+		if err != nil {
+			t.Errorf("ReadFile(%s) failed: %v", name, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("ReadFile(%s) = %q, want %q", name, data, want)
+		}
+	}
+
+	// collide-2000403 hashes to the DIR_ITEM of collide-1371839 but does
+	// not exist.
+	if _, err := filesystem.Stat("/collide/collide-2000403"); !errors.Is(err, errors.ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+}
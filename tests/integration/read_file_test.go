@@ -1,6 +1,11 @@
 package integration
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
 	"testing"
 
 	"github.com/WinBeyond/btrfs-read/pkg/fs"
@@ -43,3 +48,184 @@ func TestReadFileBasic(t *testing.T) {
 		t.Errorf("Expected %q, got %q", expected, string(data))
 	}
 }
+
+// openTestFilesystem opens the test image, skipping the test when it has not been created.
+func openTestFilesystem(t *testing.T) *fs.FileSystem {
+	t.Helper()
+
+	if _, err := os.Stat(testImagePath); os.IsNotExist(err) {
+		t.Skip("Test image not found. Run 'make create-test-image' first.")
+	}
+
+	filesystem, err := fs.Open(testImagePath)
+	if err != nil {
+		t.Fatalf("Failed to open filesystem: %v", err)
+	}
+	t.Cleanup(func() { filesystem.Close() })
+
+	return filesystem
+}
+
+func TestReadFileMultiExtent(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	// The test script writes 1MiB of 'A', leaves a 1MiB hole and then
+	// writes 1MiB of 'B', producing two extents around a hole.
+	data, err := filesystem.ReadFile("/multi-extent.bin")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	const mib = 1024 * 1024
+	if len(data) != 3*mib {
+		t.Fatalf("Expected %d bytes, got %d", 3*mib, len(data))
+	}
+
+	expected := append(bytes.Repeat([]byte{'A'}, mib), make([]byte, mib)...)
+	expected = append(expected, bytes.Repeat([]byte{'B'}, mib)...)
+	if !bytes.Equal(data, expected) {
+		t.Error("Multi-extent file content mismatch")
+	}
+}
+
+func TestReadFileCompressed(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	for _, alg := range []string{"zlib", "lzo", "zstd"} {
+		t.Run(alg, func(t *testing.T) {
+			var expected bytes.Buffer
+			for i := 1; i <= 2000; i++ {
+				fmt.Fprintf(&expected, "line %d of a compressible %s file\n", i, alg)
+			}
+
+			data, err := filesystem.ReadFile("/compressed-" + alg + ".txt")
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			if !bytes.Equal(data, expected.Bytes()) {
+				t.Errorf("Content mismatch: got %d bytes, want %d", len(data), expected.Len())
+			}
+		})
+	}
+}
+
+func TestOpenFileReadAt(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	f, err := filesystem.OpenFile("/multi-extent.bin")
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	const mib = 1024 * 1024
+	if f.Size() != 3*mib {
+		t.Fatalf("Expected size %d, got %d", 3*mib, f.Size())
+	}
+
+	tests := []struct {
+		name string
+		off  int64
+		want []byte
+	}{
+		{"first extent", 100, bytes.Repeat([]byte{'A'}, 16)},
+		{"into hole", mib - 4, []byte{'A', 'A', 'A', 'A', 0, 0, 0, 0}},
+		{"out of hole", 2*mib - 4, []byte{0, 0, 0, 0, 'B', 'B', 'B', 'B'}},
+		{"last bytes", 3*mib - 8, bytes.Repeat([]byte{'B'}, 8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, len(tt.want))
+			n, err := f.ReadAt(buf, tt.off)
+			if err != nil || n != len(buf) {
+				t.Fatalf("ReadAt(%d) = %d, %v", tt.off, n, err)
+			}
+			if !bytes.Equal(buf, tt.want) {
+				t.Errorf("ReadAt(%d) = %v, want %v", tt.off, buf, tt.want)
+			}
+		})
+	}
+
+	// A read past the end is short and reports io.EOF.
+	buf := make([]byte, 16)
+	n, err := f.ReadAt(buf, 3*mib-4)
+	if n != 4 || err != io.EOF {
+		t.Errorf("Expected 4 bytes and io.EOF at end of file, got %d, %v", n, err)
+	}
+}
+
+func TestOpenFileConcurrentReadAt(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	for _, path := range []string{"/multi-extent.bin", "/compressed-zstd.txt"} {
+		t.Run(path, func(t *testing.T) {
+			data, err := filesystem.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+
+			f, err := filesystem.OpenFile(path)
+			if err != nil {
+				t.Fatalf("OpenFile failed: %v", err)
+			}
+			defer f.Close()
+
+			// Each goroutine walks its own part of the file with small
+			// buffered reads and one large unbuffered one, so the window
+			// buffer and the extent cache are shared between them.
+			const workers = 8
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					start := len(data) * w / workers
+					end := len(data) * (w + 1) / workers
+					buf := make([]byte, 4000)
+					for off := start; off < end; off += len(buf) {
+						n, err := f.ReadAt(buf, int64(off))
+						if err != nil && err != io.EOF {
+							t.Errorf("ReadAt(%d) failed: %v", off, err)
+							return
+						}
+						if !bytes.Equal(buf[:n], data[off:off+n]) {
+							t.Errorf("ReadAt(%d) does not match ReadFile", off)
+							return
+						}
+					}
+					big := make([]byte, end-start)
+					if n, err := f.ReadAt(big, int64(start)); n != len(big) || !bytes.Equal(big, data[start:end]) {
+						t.Errorf("ReadAt(%d, %d bytes) = %d, %v, does not match ReadFile", start, len(big), n, err)
+					}
+				}(w)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestOpenFileSeekRead(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	data, err := filesystem.ReadFile("/compressed-zstd.txt")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	f, err := filesystem.OpenFile("/compressed-zstd.txt")
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(int64(len(data)/2), io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(rest, data[len(data)/2:]) {
+		t.Error("Content after Seek does not match ReadFile")
+	}
+}
@@ -0,0 +1,72 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+func TestStat(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	info, err := filesystem.Stat("/hello.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+
+	if info.Size != uint64(len("Hello Btrfs!\n")) {
+		t.Errorf("Size = %d, want %d", info.Size, len("Hello Btrfs!\n"))
+	}
+	if info.Mode&ondisk.ModeTypeMask != ondisk.ModeRegular {
+		t.Errorf("Mode = %o, want a regular file", info.Mode)
+	}
+	if info.NLink != 1 {
+		t.Errorf("NLink = %d, want 1", info.NLink)
+	}
+	if info.Generation == 0 || info.TransID < info.Generation {
+		t.Errorf("Unexpected generation %d / transid %d", info.Generation, info.TransID)
+	}
+	if info.OTime.Sec == 0 || info.MTime.Sec == 0 {
+		t.Errorf("Missing timestamps: otime=%v mtime=%v", info.OTime, info.MTime)
+	}
+
+	// StatInode returns the same item.
+	byIno, err := filesystem.StatInode(info.Ino)
+	if err != nil {
+		t.Fatalf("StatInode failed: %v", err)
+	}
+	if *byIno != *info {
+		t.Errorf("StatInode(%d) = %+v, want %+v", info.Ino, byIno, info)
+	}
+}
+
+func TestStatDirectory(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	info, err := filesystem.Stat("/")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Ino != 256 {
+		t.Errorf("Root inode = %d, want 256", info.Ino)
+	}
+	if !info.FileMode().IsDir() {
+		t.Errorf("Root mode = %v, want a directory", info.FileMode())
+	}
+	if info.NLink != 1 {
+		// Btrfs keeps directory link counts at 1.
+		t.Errorf("Root NLink = %d, want 1", info.NLink)
+	}
+}
+
+func TestStatNotFound(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	if _, err := filesystem.Stat("/does-not-exist"); !errors.Is(err, errors.ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+	if _, err := filesystem.StatInode(1 << 40); !errors.Is(err, errors.ErrInodeNotFound) {
+		t.Errorf("Expected ErrInodeNotFound, got %v", err)
+	}
+}
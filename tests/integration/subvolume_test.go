@@ -0,0 +1,185 @@
+package integration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/fs"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+func TestListSubvolumes(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	subvols, err := filesystem.ListSubvolumes()
+	if err != nil {
+		t.Fatalf("ListSubvolumes failed: %v", err)
+	}
+
+	var lastID uint64
+	for _, sv := range subvols {
+		t.Logf("subvolume %d: %s (parent %d)", sv.ID, sv.Path, sv.ParentID)
+
+		if sv.ID < 256 || sv.ID <= lastID {
+			t.Errorf("subvolume IDs not sorted or out of range: %d after %d", sv.ID, lastID)
+		}
+		lastID = sv.ID
+
+		if sv.Path == "" || strings.HasPrefix(sv.Path, "/") {
+			t.Errorf("subvolume %d: path %q should be relative to the top level", sv.ID, sv.Path)
+		}
+		if !strings.HasSuffix(sv.Path, sv.Name) {
+			t.Errorf("subvolume %d: path %q does not end in name %q", sv.ID, sv.Path, sv.Name)
+		}
+		if sv.UUID.IsZero() {
+			t.Errorf("subvolume %d has no UUID", sv.ID)
+		}
+	}
+
+	byPath := make(map[string]*fs.Subvolume)
+	for _, sv := range subvols {
+		byPath[sv.Path] = sv
+	}
+
+	home, snap := byPath["home"], byPath["snapshots/home-snap"]
+	if home == nil || snap == nil {
+		t.Fatalf("Expected subvolumes home and snapshots/home-snap, got %d subvolumes", len(subvols))
+	}
+	if home.ParentID != 5 || home.Readonly || home.IsSnapshot() {
+		t.Errorf("home: parent %d, readonly %v, snapshot %v", home.ParentID, home.Readonly, home.IsSnapshot())
+	}
+	if !snap.Readonly || snap.ParentUUID != home.UUID {
+		t.Errorf("home-snap: readonly %v, parent_uuid %s, want true and %s", snap.Readonly, snap.ParentUUID, home.UUID)
+	}
+}
+
+func TestSubvolumeTraversal(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/home/user/data.txt", "user data\n"},
+		{"/home/user/new.txt", "new file\n"},
+		{"/snapshots/home-snap/user/data.txt", "user data\n"},
+		{"/home/../hello.txt", "Hello Btrfs!\n"},
+		{"/snapshots/home-snap/user/../../../test.txt", "This is a test file for Btrfs read service.\n"},
+		{"/abs-link.txt", "user data\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			data, err := filesystem.ReadFile(tt.path)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("ReadFile = %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	// The snapshot was taken before new.txt was written.
+	if _, err := filesystem.ReadFile("/snapshots/home-snap/user/new.txt"); !errors.Is(err, errors.ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound for a file newer than the snapshot, got %v", err)
+	}
+
+	// A subvolume is listed in its parent as a directory whose inode is
+	// the subvolume's root directory.
+	entries, err := filesystem.ListDirectory("/")
+	if err != nil {
+		t.Fatalf("ListDirectory failed: %v", err)
+	}
+	var home *fs.DirEntry
+	for _, entry := range entries {
+		if entry.Name == "home" {
+			home = entry
+		}
+	}
+	if home == nil || !home.IsDir || home.Subvolume == 0 || home.Inode != ondisk.FirstFreeObjectid {
+		t.Fatalf("Unexpected entry for home: %+v", home)
+	}
+
+	info, err := filesystem.Stat("/home")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Ino != ondisk.FirstFreeObjectid || !info.FileMode().IsDir() {
+		t.Errorf("Stat(/home) = inode %d mode %v, want the subvolume root directory", info.Ino, info.FileMode())
+	}
+
+	users, err := filesystem.ListDirectory("/home/user")
+	if err != nil || len(users) != 2 {
+		t.Errorf("ListDirectory(/home/user) = %d entries, %v, want 2", len(users), err)
+	}
+}
+
+func TestOpenSubvolume(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	defaultID, err := filesystem.DefaultSubvolumeID()
+	if err != nil {
+		t.Fatalf("DefaultSubvolumeID failed: %v", err)
+	}
+	if filesystem.SubvolumeID() != defaultID {
+		t.Errorf("Open browses subvolume %d, want the default %d", filesystem.SubvolumeID(), defaultID)
+	}
+
+	top, err := filesystem.OpenSubvolumeByPath("/")
+	if err != nil {
+		t.Fatalf("OpenSubvolumeByPath(/) failed: %v", err)
+	}
+	if top.SubvolumeID() != 5 {
+		t.Errorf("OpenSubvolumeByPath(/) opened subvolume %d, want 5", top.SubvolumeID())
+	}
+	if _, err := top.ReadFile("/hello.txt"); err != nil {
+		t.Errorf("ReadFile in the top-level subvolume failed: %v", err)
+	}
+
+	snap, err := filesystem.OpenSubvolumeByPath("snapshots/home-snap")
+	if err != nil {
+		t.Fatalf("OpenSubvolumeByPath failed: %v", err)
+	}
+	data, err := snap.ReadFile("/user/data.txt")
+	if err != nil || string(data) != "user data\n" {
+		t.Errorf("ReadFile in the snapshot = %q, %v", data, err)
+	}
+
+	byID, err := filesystem.OpenSubvolume(snap.SubvolumeID())
+	if err != nil {
+		t.Fatalf("OpenSubvolume(%d) failed: %v", snap.SubvolumeID(), err)
+	}
+	if _, err := byID.Stat("/user"); err != nil {
+		t.Errorf("Stat in subvolume %d failed: %v", snap.SubvolumeID(), err)
+	}
+
+	// Closing a subvolume view must not close the shared device.
+	top.Close()
+	if _, err := filesystem.ReadFile("/hello.txt"); err != nil {
+		t.Errorf("ReadFile after closing a subvolume view failed: %v", err)
+	}
+}
+
+func TestOpenSubvolumeErrors(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	tests := []struct {
+		name string
+		open func() (*fs.FileSystem, error)
+	}{
+		{"tree that is not a subvolume", func() (*fs.FileSystem, error) { return filesystem.OpenSubvolume(ondisk.ExtentTreeObjectid) }},
+		{"missing ID", func() (*fs.FileSystem, error) { return filesystem.OpenSubvolume(100000) }},
+		{"missing path", func() (*fs.FileSystem, error) { return filesystem.OpenSubvolumeByPath("/no/such/subvol") }},
+		{"missing UUID", func() (*fs.FileSystem, error) { return filesystem.OpenSubvolumeByUUID(ondisk.UUID{0xff}) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.open(); !errors.Is(err, errors.ErrSubvolumeNotFound) {
+				t.Errorf("Expected ErrSubvolumeNotFound, got %v", err)
+			}
+		})
+	}
+}
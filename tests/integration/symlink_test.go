@@ -0,0 +1,95 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+	"github.com/WinBeyond/btrfs-read/pkg/ondisk"
+)
+
+func TestReadlink(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	tests := []struct {
+		path   string
+		target string
+	}{
+		{"/link.txt", "hello.txt"},
+		{"/nested-link", "deep/nested"},
+		{"/abs-link.txt", "/home/user/data.txt"},
+	}
+	for _, tt := range tests {
+		target, err := filesystem.Readlink(tt.path)
+		if err != nil {
+			t.Errorf("Readlink(%s) failed: %v", tt.path, err)
+			continue
+		}
+		if target != tt.target {
+			t.Errorf("Readlink(%s) = %q, want %q", tt.path, target, tt.target)
+		}
+	}
+
+	if _, err := filesystem.Readlink("/hello.txt"); !errors.Is(err, errors.ErrNotSymlink) {
+		t.Errorf("Expected ErrNotSymlink for a regular file, got %v", err)
+	}
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/link.txt", "Hello Btrfs!\n"},
+		{"/abs-link.txt", "user data\n"},
+		{"/nested-link/directory/structure/file.txt", "deep file\n"},
+		{"/nested-link/../../hello.txt", "Hello Btrfs!\n"},
+	}
+	for _, tt := range tests {
+		data, err := filesystem.ReadFile(tt.path)
+		if err != nil {
+			t.Errorf("ReadFile(%s) failed: %v", tt.path, err)
+			continue
+		}
+		if string(data) != tt.want {
+			t.Errorf("ReadFile(%s) = %q, want %q", tt.path, data, tt.want)
+		}
+	}
+
+	entries, err := filesystem.ListDirectory("/nested-link")
+	if err != nil {
+		t.Fatalf("ListDirectory through symlink failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "directory" {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+}
+
+func TestLstat(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	link, err := filesystem.Lstat("/link.txt")
+	if err != nil {
+		t.Fatalf("Lstat failed: %v", err)
+	}
+	if link.Mode&ondisk.ModeTypeMask != ondisk.ModeSymlink {
+		t.Errorf("Lstat mode = %o, want a symlink", link.Mode)
+	}
+
+	target, err := filesystem.Stat("/link.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	hello, err := filesystem.Stat("/hello.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if target.Ino != hello.Ino {
+		t.Errorf("Stat(/link.txt) = inode %d, want %d", target.Ino, hello.Ino)
+	}
+
+	if _, err := filesystem.Stat("/hello.txt/x"); !errors.Is(err, errors.ErrNotDirectory) {
+		t.Errorf("Expected ErrNotDirectory, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/WinBeyond/btrfs-read/pkg/errors"
+)
+
+func TestListXattrs(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	xattrs, err := filesystem.ListXattrs("/hello.txt")
+	if err != nil {
+		t.Fatalf("ListXattrs failed: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, x := range xattrs {
+		got[x.Name] = string(x.Value)
+	}
+
+	want := map[string]string{
+		"user.comment":         "hello xattr",
+		"user.collide-1371838": "first",
+		"user.collide-2000402": "second",
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("xattr %s = %q, want %q", name, got[name], value)
+		}
+	}
+	if _, ok := got["system.posix_acl_access"]; !ok {
+		t.Error("system.posix_acl_access not listed")
+	}
+}
+
+func TestGetXattrCollision(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	// Both names hash to the same XATTR_ITEM key.
+	for name, want := range map[string]string{
+		"user.collide-1371838": "first",
+		"user.collide-2000402": "second",
+	} {
+		value, err := filesystem.GetXattr("/hello.txt", name)
+		if err != nil {
+			t.Errorf("GetXattr(%s) failed: %v", name, err)
+			continue
+		}
+		if string(value) != want {
+			t.Errorf("GetXattr(%s) = %q, want %q", name, value, want)
+		}
+	}
+
+	if _, err := filesystem.GetXattr("/hello.txt", "user.missing"); !errors.Is(err, errors.ErrXattrNotFound) {
+		t.Errorf("Expected ErrXattrNotFound, got %v", err)
+	}
+}
+
+func TestGetACL(t *testing.T) {
+	filesystem := openTestFilesystem(t)
+
+	access, err := filesystem.GetACL("/hello.txt", false)
+	if err != nil {
+		t.Fatalf("GetACL failed: %v", err)
+	}
+	wantAccess := []string{"user::rw-", "user:1000:r--", "group::r--", "mask::r--", "other::r--"}
+	checkACL(t, "access", access, wantAccess)
+
+	defaults, err := filesystem.GetACL("/etc", true)
+	if err != nil {
+		t.Fatalf("GetACL default failed: %v", err)
+	}
+	wantDefault := []string{"user::rwx", "user:1000:rwx", "group::r-x", "mask::rwx", "other::r-x"}
+	checkACL(t, "default", defaults, wantDefault)
+
+	if _, err := filesystem.GetACL("/test.txt", false); !errors.Is(err, errors.ErrXattrNotFound) {
+		t.Errorf("Expected ErrXattrNotFound for a file without ACL, got %v", err)
+	}
+}
+
+func checkACL[T interface{ String() string }](t *testing.T, kind string, got []T, want []string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%s ACL has %d entries, want %d", kind, len(got), len(want))
+	}
+	for i, e := range got {
+		if e.String() != want[i] {
+			t.Errorf("%s ACL entry %d = %q, want %q", kind, i, e.String(), want[i])
+		}
+	}
+}